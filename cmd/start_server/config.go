@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jessevdk/go-flags"
+	"github.com/lestrrat/go-server-starter"
+	"gopkg.in/yaml.v2"
+)
+
+// configOnly are the options that can not be given in a configuration file
+var configOnly = map[string]bool{
+	"config":  true,
+	"ctl":     true,
+	"help":    true,
+	"version": true,
+}
+
+// setOnCommandLine returns the long names of the options given on the
+// command line, which take precedence over the configuration file
+func setOnCommandLine(p *flags.Parser) map[string]bool {
+	set := make(map[string]bool)
+	t := reflect.TypeOf(options{})
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("long")
+		if name == "" {
+			continue
+		}
+		if o := p.FindOptionByLongName(name); o != nil && o.IsSet() {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// loadConfig reads the configuration file, and sets the options it
+// contains that were not given on the command line
+func (o *options) loadConfig() error {
+	m, err := readConfigFile(o.OptConfig)
+	if err != nil {
+		return err
+	}
+	if err := o.applyConfig(m); err != nil {
+		return fmt.Errorf("%s: %s", o.OptConfig, err)
+	}
+	return nil
+}
+
+// applyConfig sets the options named by the keys of m, which are the
+// long names of the options (with "-" or "_" between words), plus
+// "command" for the server program and its arguments. Keys with a null
+// value are ignored
+func (o *options) applyConfig(m map[string]interface{}) error {
+	v := reflect.ValueOf(o).Elem()
+	t := v.Type()
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("long"); name != "" && !configOnly[name] {
+			fields[name] = i
+		}
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		name := strings.Replace(k, "_", "-", -1)
+		if name == "command" {
+			cmd, err := configStrings(m[k])
+			if err != nil {
+				return fmt.Errorf("command: %s", err)
+			}
+			o.configCommand = cmd
+			continue
+		}
+
+		i, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("unknown option %q", k)
+		}
+		if o.serviceName != "" && processOptions[name] {
+			return fmt.Errorf("%s can not be set for a service", k)
+		}
+		if o.cliSet[name] || m[k] == nil {
+			continue
+		}
+		if err := setConfigField(v.Field(i), m[k]); err != nil {
+			return fmt.Errorf("%s: %s", k, err)
+		}
+	}
+	return nil
+}
+
+// Reload reads the configuration file again, and returns a copy of o
+// in which only the options that the starter picks up on SIGHUP are
+// updated, the rest keep the values start_server was started with
+func (o *options) Reload() (starter.Config, error) {
+	if o.OptConfig == "" {
+		return o, nil
+	}
+
+	next := *o.cli
+	if err := next.loadConfig(); err != nil {
+		return nil, err
+	}
+	if next.OptInterval < 0 {
+		next.OptInterval = 1
+	}
+	for _, name := range []string{next.OptSignalOnHUP, next.OptSignalOnTERM} {
+		if name != "" && starter.SigFromName(name) == nil {
+			return nil, fmt.Errorf("unknown signal %s", name)
+		}
+	}
+
+	c := *o
+	c.OptPorts = next.OptPorts
+	c.OptPaths = next.OptPaths
+	c.OptSystemdSockets = next.OptSystemdSockets
+	c.OptSignalOnHUP = next.OptSignalOnHUP
+	c.OptSignalOnTERM = next.OptSignalOnTERM
+	c.OptInterval = next.OptInterval
+	c.OptEnvdir = next.OptEnvdir
+	c.OptEnvFiles = next.OptEnvFiles
+	return &c, nil
+}
+
+// setConfigField sets an option field from a value read from the
+// configuration file
+func setConfigField(f reflect.Value, val interface{}) error {
+	switch f.Kind() {
+	case reflect.String:
+		s, err := configString(val)
+		if err != nil {
+			return err
+		}
+		f.SetString(s)
+	case reflect.Int:
+		n, err := configInt(val)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Bool:
+		b, ok := val.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %v", val)
+		}
+		f.SetBool(b)
+	case reflect.Slice:
+		list, err := configStrings(val)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported option type %s", f.Type())
+	}
+	return nil
+}
+
+// configString converts a scalar to a string, so that e.g. a port may
+// be given as a number
+func configString(val interface{}) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("expected a string, got %v", val)
+}
+
+func configInt(val interface{}) (int64, error) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("expected an integer, got %v", val)
+}
+
+// configStrings converts an array, or a single scalar, to a list of
+// strings
+func configStrings(val interface{}) ([]string, error) {
+	list, ok := val.([]interface{})
+	if !ok {
+		list = []interface{}{val}
+	}
+	ret := make([]string, 0, len(list))
+	for _, v := range list {
+		s, err := configString(v)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+	return ret, nil
+}
+
+// readConfigFile reads a configuration file in the format given by its
+// extension: .json, .yaml/.yml, or else TOML
+func readConfigFile(fn string) (map[string]interface{}, error) {
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".json":
+		err = json.Unmarshal(buf, &m)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(buf, &m)
+	default:
+		_, err = toml.Decode(string(buf), &m)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	return m, nil
+}
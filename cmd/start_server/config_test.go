@@ -0,0 +1,178 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "start-server-config")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	read := func(name, content string) (map[string]interface{}, error) {
+		fn := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", fn, err)
+		}
+		return readConfigFile(fn)
+	}
+
+	files := map[string]string{
+		"app.toml": `
+# comment
+port = ["8080", "127.0.0.1:8081"] # trailing comment
+path = [
+  "/tmp/app.sock,mode=0660",
+  '/tmp/#literal',
+]
+"signal-on-hup" = "USR1"
+interval = 1_0
+child_subreaper = true
+`,
+		"app.yaml": `---
+# comment
+port:
+  - 8080
+  - "127.0.0.1:8081" # comment
+path: ['/tmp/app.sock,mode=0660', '/tmp/#literal']
+signal-on-hup: USR1
+interval: 10
+child_subreaper: true
+dir: ~
+`,
+		"app.json": `{"port": [8080, "127.0.0.1:8081"], "path": ["/tmp/app.sock,mode=0660", "/tmp/#literal"], "signal-on-hup": "USR1", "interval": 10, "child_subreaper": true}`,
+	}
+	for name, content := range files {
+		m, err := read(name, content)
+		if err != nil {
+			t.Errorf("readConfigFile(%s) failed: %s", name, err)
+			continue
+		}
+		o := &options{}
+		if err := o.applyConfig(m); err != nil {
+			t.Errorf("applyConfig(%s) failed: %s", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(o.OptPorts, []string{"8080", "127.0.0.1:8081"}) || len(o.OptPaths) != 2 || o.OptPaths[1] != "/tmp/#literal" ||
+			o.OptSignalOnHUP != "USR1" || o.OptInterval != 10 || !o.OptChildSubreaper || o.OptDir != "" {
+			t.Errorf("Unexpected options from %s: %#v", name, o)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"bad.toml": "port = [80",
+		"bad.yaml": "port: [80",
+		"bad.json": `{"port": [80}`,
+		"dup.toml": "port = 80\nport = 81",
+	} {
+		if _, err := read(name, content); err == nil {
+			t.Errorf("Expected readConfigFile(%s) to fail", name)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	o := &options{
+		OptInterval: 5,
+		cliSet:      map[string]bool{"interval": true},
+	}
+	err := o.applyConfig(map[string]interface{}{
+		"port":            float64(8080),
+		"interval":        int64(1),
+		"signal_on_hup":   "USR1",
+		"child-subreaper": true,
+		"kill-old-delay":  "3",
+		"command":         []interface{}{"plackup", "-s", "Starlet"},
+	})
+	if err != nil {
+		t.Fatalf("applyConfig failed: %s", err)
+	}
+	if !reflect.DeepEqual(o.OptPorts, []string{"8080"}) {
+		t.Errorf("Expected ports [8080], got %v", o.OptPorts)
+	}
+	if o.OptInterval != 5 {
+		t.Errorf("Expected interval from the command line to take precedence, got %d", o.OptInterval)
+	}
+	if o.OptSignalOnHUP != "USR1" || !o.OptChildSubreaper || o.OptKillOldDelay != 3 {
+		t.Errorf("Expected options to be set from the file, got %#v", o)
+	}
+	if !reflect.DeepEqual(o.configCommand, []string{"plackup", "-s", "Starlet"}) {
+		t.Errorf("Expected command from the file, got %v", o.configCommand)
+	}
+
+	for _, m := range []map[string]interface{}{
+		{"no-such-option": "1"},
+		{"config": "other.toml"},
+		{"interval": "soon"},
+		{"daemon": "yes"},
+		{"port": []interface{}{map[string]interface{}{}}},
+	} {
+		if err := (&options{}).applyConfig(m); err == nil {
+			t.Errorf("Expected applyConfig(%v) to fail", m)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "start-server-config")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "app.json")
+	write := func(s string) {
+		if err := ioutil.WriteFile(fn, []byte(s), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", fn, err)
+		}
+	}
+	write(`{"port": [8080], "interval": 2, "user": "nobody"}`)
+
+	o := &options{
+		OptConfig:   fn,
+		OptInterval: -1,
+		OptDir:      "/srv",
+		cliSet:      map[string]bool{"dir": true},
+	}
+	cli := *o
+	o.cli = &cli
+	if err := o.loadConfig(); err != nil {
+		t.Fatalf("loadConfig failed: %s", err)
+	}
+	if o.OptInterval != 2 || o.OptUser != "nobody" {
+		t.Fatalf("Expected options from the file, got %#v", o)
+	}
+
+	write(`{"port": [8081], "signal-on-hup": "USR1", "user": "root", "dir": "/tmp"}`)
+	c, err := o.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed: %s", err)
+	}
+	if !reflect.DeepEqual(o.OptPorts, []string{"8080"}) {
+		t.Errorf("Expected Reload to leave the options alone, got ports %v", o.OptPorts)
+	}
+	o = c.(*options)
+	if !reflect.DeepEqual(o.OptPorts, []string{"8081"}) || o.OptSignalOnHUP != "USR1" {
+		t.Errorf("Expected ports and signal to be reloaded, got %v and %s", o.OptPorts, o.OptSignalOnHUP)
+	}
+	if o.OptInterval != 1 {
+		t.Errorf("Expected interval to go back to the default, got %d", o.OptInterval)
+	}
+	if o.OptUser != "nobody" || o.OptDir != "/srv" {
+		t.Errorf("Expected user and dir to be left alone, got %s and %s", o.OptUser, o.OptDir)
+	}
+
+	write(`{"signal-on-hup": "NOSUCHSIG"}`)
+	if _, err := o.Reload(); err == nil {
+		t.Errorf("Expected Reload with an unknown signal to fail")
+	}
+	if o.OptSignalOnHUP != "USR1" {
+		t.Errorf("Expected a failed reload to leave the options alone, got %s", o.OptSignalOnHUP)
+	}
+}
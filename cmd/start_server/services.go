@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lestrrat/go-server-starter"
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+// processOptions concern start_server itself rather than one of its
+// services, and can not be set in the file of a service
+var processOptions = map[string]bool{
+	"child-subreaper":          true,
+	"control":                  true,
+	"daemon":                   true,
+	"log-file":                 true,
+	"log-file-max-backups":     true,
+	"log-file-max-size":        true,
+	"log-file-rotate-interval": true,
+	"log-format":               true,
+	"pid-file":                 true,
+	"service":                  true,
+	"syslog":                   true,
+	"syslog-addr":              true,
+	"syslog-priority":          true,
+	"syslog-tag":               true,
+}
+
+// loadServices reads the file of each --service. The services share
+// the log of start_server, with their names prefixed to the messages
+func (o *options) loadServices() error {
+	for _, spec := range o.OptServices {
+		i := strings.IndexByte(spec, '=')
+		if i <= 0 || i == len(spec)-1 {
+			return fmt.Errorf("invalid --service %q, expected name=filename", spec)
+		}
+		name, fn := spec[:i], spec[i+1:]
+
+		svc := &options{
+			OptConfig:   fn,
+			OptInterval: -1,
+			logger:      logger.Tagged(o.logger, name),
+			logRotation: o.logRotation,
+			serviceName: name,
+		}
+		cli := *svc
+		svc.cli = &cli
+		if err := svc.loadConfig(); err != nil {
+			return err
+		}
+
+		if len(svc.configCommand) == 0 {
+			return fmt.Errorf("%s: server program not specified", fn)
+		}
+		svc.OptCommand = svc.configCommand[0]
+		svc.OptArgs = svc.configCommand[1:]
+		if svc.OptInterval < 0 {
+			svc.OptInterval = 1
+		}
+		if svc.OptSignalOnDeath != "" && starter.SigFromName(svc.OptSignalOnDeath) == nil {
+			return fmt.Errorf("%s: unknown signal %s", fn, svc.OptSignalOnDeath)
+		}
+
+		o.services = append(o.services, starter.Service{Name: name, Config: svc})
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+func TestLoadServices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "start-server-services")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, s string) string {
+		fn := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fn, []byte(s), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", fn, err)
+		}
+		return fn
+	}
+	web := write("web.toml", `port = [8080]
+restart-policy = "on-failure"
+command = ["plackup", "-s", "Starlet"]
+`)
+	api := write("api.yaml", "command: [api-server]\n")
+
+	o := &options{
+		OptServices: []string{"web=" + web, "api=" + api},
+		logger:      logger.NewStderr(),
+	}
+	if err := o.loadServices(); err != nil {
+		t.Fatalf("loadServices failed: %s", err)
+	}
+	if len(o.services) != 2 || o.services[0].Name != "web" || o.services[1].Name != "api" {
+		t.Fatalf("Expected services web and api, got %#v", o.services)
+	}
+	c := o.services[0].Config
+	if c.Command() != "plackup" || !reflect.DeepEqual(c.Args(), []string{"-s", "Starlet"}) {
+		t.Errorf("Expected the command of web to be plackup -s Starlet, got %s %v", c.Command(), c.Args())
+	}
+	if !reflect.DeepEqual(c.Ports(), []string{"8080"}) || c.RestartPolicy() != "on-failure" || c.Interval() == 0 {
+		t.Errorf("Expected the options of web to be read from %s, got %#v", web, c)
+	}
+	if o.services[1].Config.Ports() != nil {
+		t.Errorf("Expected api to have no ports, got %v", o.services[1].Config.Ports())
+	}
+
+	for _, spec := range []string{
+		"web",
+		"=" + web,
+		"web=",
+		"web=" + write("pid.toml", "pid-file = \"/tmp/web.pid\"\ncommand = [\"true\"]\n"),
+		"web=" + write("nocommand.toml", "port = [8080]\n"),
+	} {
+		o := &options{OptServices: []string{spec}, logger: logger.NewStderr()}
+		if err := o.loadServices(); err == nil {
+			t.Errorf("Expected loadServices to fail for --service=%s", spec)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,15 +19,34 @@ const version = "0.0.2"
 type options struct {
 	OptArgs                []string
 	OptCommand             string
+	OptConfig              string   `long:"config" arg:"filename" description:"file to read options from, in TOML, or in YAML or JSON when its name ends\nwith \".yaml\", \".yml\" or \".json\". Keys are the long names of the options\n(e.g. port = [\"8080\", \"8081\"], signal-on-hup = \"USR1\"), and \"command\" is\nthe server program and its arguments. Only keys with strings, numbers,\nbooleans or lists of those are supported. Options given on the command line\ntake precedence. On SIGHUP, the file is read again and changes to the\nports, paths, signals, interval, envdir and env files apply to the next\ngeneration; other options require a restart."`
+	OptServices            []string `long:"service" arg:"name=filename" description:"runs the service of the given name, with the options read from the file as\nwith --config (e.g. --service=web=/etc/start_server/web.toml). Can be\nspecified multiple times, to run several services, each with its own\nports, server program, status file and restart policy, in one\nstart_server. The files may not set the options that concern\nstart_server itself, such as --pid-file or those of the log. The signals\nstart_server receives are passed on to every service, except SIGUSR2:\nstart_server can not upgrade itself when running services. Without\n--control, start_server exits once no service is running any more."`
+	OptControl             string   `long:"control" arg:"path" description:"path of a UNIX socket at where start_server, when running services,\naccepts commands to start, stop or restart a single service or to show\nthe status of the services (see --ctl)"`
+	OptCtl                 string   `long:"ctl" arg:"command" description:"sends the command to the start_server listening to the --control socket,\nprints the reply and exits. Commands are:\n  status [name...], start name..., stop name..., restart name...\nwhere restart replaces the server processes of the service as SIGHUP\ndoes (e.g. --control=/run/start_server.sock --ctl=\"restart web\")"`
 	OptDir                 string   `long:"dir" arg:"path" description:"working directory, start_server do chdir to before exec (optional)"`
+	OptRestartPolicy       string   `long:"restart-policy" arg:"(always|on-failure|never)" description:"whether to start a new server process when the current one exits on its\nown: \"always\", only when it exits with a non-zero status or is killed by\na signal (\"on-failure\"), or \"never\". When it is not replaced,\nstart_server (or the service) stops (default: always)"`
 	OptInterval            int      `long:"interval" arg:"seconds" description:"minimum interval (in seconds) to respawn the server program (default: 1)"`
-	OptPorts               []string `long:"port" arg:"(port|host:port)" description:"TCP port to listen to (if omitted, will not bind to any ports)"`
-	OptPaths               []string `long:"path" arg:"path" description:"path at where to listen using unix socket (optional)"`
+	OptPorts               []string `long:"port" arg:"(port|host:port)[,option...]" description:"TCP port to listen to (if omitted, will not bind to any ports).\nSocket options may follow the address, separated by commas:\n  backlog=N, reuseport, defer_accept[=secs], fastopen=N, v6only,\n  keepalive[=secs]\n(e.g. --port=127.0.0.1:8080,backlog=1024,reuseport)"`
+	OptPaths               []string `long:"path" arg:"path[,option...]" description:"path at where to listen using unix socket (optional).\nOwnership and permissions may follow the path, separated by commas:\n  mode=0660, owner=user, group=group\n(e.g. --path=/tmp/app.sock,mode=0660,group=www-data)\nOn Linux, a path starting with '@' binds an abstract socket, which has no\nfile to clean up (e.g. --path=@myapp.sock)."`
+	OptSystemdSockets      []string `long:"systemd-socket" arg:"name" description:"name (FileDescriptorName= in the .socket unit) of the sockets passed by\nsystemd socket activation to give to the server program after those of\n--port and --path. start_server fails to start if none has the name. Can\nbe specified multiple times. Sockets whose address is that of a --port or\n--path are used for it instead of binding, and the others are given to the\nserver program last (optional)."`
 	OptSignalOnHUP         string   `long:"signal-on-hup" arg:"Signal" description:"name of the signal to be sent to the server process when start_server\nreceives a SIGHUP (default: SIGTERM). If you use this option, be sure to\nalso use '--signal-on-term' below."`
 	OptSignalOnTERM        string   `long:"signal-on-term" arg:"Signal" description:"name of the signal to be sent to the server process when start_server\nreceives a SIGTERM (default: SIGTERM)"`
-	OptPidFile             string   `long:"pid-file" arg:"filename" description:"if set, writes the process id of the start_server process to the file"`
+	OptPidFile             string   `long:"pid-file" arg:"filename" description:"if set, writes the process id of the start_server process to the file.\nThe file is locked while start_server runs, and start_server refuses to\nstart if another instance is using it."`
 	OptStatusFile          string   `long:"status-file" arg:"filename" description:"if set, writes the status of the server process(es) to the file"`
+	OptUser                string   `long:"user" arg:"user" description:"name or uid of the user to run the server processes as. The ports and\npaths are bound by start_server beforehand, so that it can be started as\nroot to bind privileged ports (optional)"`
+	OptGroup               string   `long:"group" arg:"group" description:"name or gid of the group to run the server processes as (default: the\nprimary group of --user)"`
+	OptGroups              []string `long:"groups" arg:"group" description:"supplementary group of the server processes. Can be specified multiple\ntimes (default: the groups of --user)"`
+	OptChroot              string   `long:"chroot" arg:"path" description:"directory to chroot the server processes into. The server program must\nbe given as an absolute path within it, and --dir is relative to it\n(optional)"`
+	OptSignalOnDeath       string   `long:"signal-on-parent-death" arg:"Signal" description:"name of the signal the server processes receive when start_server dies\nwithout stopping them, e.g. when it is killed with SIGKILL (optional).\nstart_server can not upgrade itself with SIGUSR2 when this is set. Linux only."`
+	OptChildSubreaper      bool     `long:"child-subreaper" description:"if set, processes orphaned by the server processes (such as those left\nby a shell wrapper) become children of start_server, which reaps them and\nlogs the generation they belonged to. Linux only."`
+	OptWatchdog            string   `long:"watchdog" arg:"option[,option...]" description:"replaces the server process, as on SIGHUP, when its memory or CPU usage\nstays above a threshold. Options, separated by commas, are:\n  rss=SIZE (e.g. 512M), cpu=N% (of one CPU), for=DURATION (default: 30s),\n  interval=DURATION (time between samples, default: 5s)\n(e.g. --watchdog=rss=1G,cpu=90%,for=1m). Only the server process itself is\nmeasured, not its children. Linux only."`
+	OptRlimits             []string `long:"rlimit" arg:"NAME=soft[:hard]" description:"resource limit the server processes start with, where NAME is one of\nNOFILE, AS, CORE or NPROC, and the limits are numbers (with an optional K,\nM or G suffix) or \"unlimited\" (e.g. --rlimit=NOFILE=65536, --rlimit=AS=2G).\nCan be specified multiple times. A server process whose limits can not be\nset counts as failing to start. Linux only."`
+	OptCgroup              string   `long:"cgroup" arg:"path[,option...]" description:"cgroup v2 directory under which each generation of server processes is\nplaced in its own cgroup, named gen-N. Limits may follow the path, separated\nby commas: memory=SIZE, cpu=N% (of one CPU)\n(e.g. --cgroup=/sys/fs/cgroup/app,memory=512M,cpu=200%)\nThe directory must not contain start_server itself. If start_server lacks\nthe permission to use it, the server processes run outside of it. Linux only."`
+	OptMetricsAddr         string   `long:"metrics-addr" arg:"[host]:port" description:"if set, serves metrics of start_server (workers spawned, failed starts,\nunexpected exits, restarts, current generation, old workers and time since\nthe last deploy) at http://[host]:port/metrics in the Prometheus text format"`
+	OptWorkerLog           string   `long:"worker-log" arg:"(logger|filename)" description:"where the stdout and stderr of the server processes go. \"logger\" sends\neach line through the start_server log (stderr or syslog), prefixed with\nthe pid and generation of the process. Anything else is the name of a file\nto append to. By default, the server processes share start_server's\nstdout and stderr. start_server can not upgrade itself with SIGUSR2 when\nthis is set."`
 	OptEnvdir              string   `long:"envdir" arg:"Envdir" description:"directory that contains environment variables to the server processes.\nIt is intended for use with \"envdir\" in \"daemontools\". This can be\noverwritten by environment variable \"ENVDIR\"."`
+	OptEnvFiles            []string `long:"env-file" arg:"filename" description:"file that contains environment variables to the server processes, in\n\"KEY=value\" lines (the format used by \".env\" files). Comments, quoting,\n\"export\" prefixes and ${VAR} expansion are supported. Can be specified\nmultiple times. The files are read after the envdir each time a server\nprocess is started, and a syntax error prevents the server from restarting."`
+	OptRedactEnv           []string `long:"redact-env" arg:"pattern" description:"when the environment of the server processes changes on restart, the\ndifferences are logged. Values of variables whose names match one of these\nglob patterns (case insensitive) are not shown. Can be specified multiple\ntimes (default: *SECRET*, *PASSWORD*, *TOKEN*, *KEY*)."`
 	OptEnableAutoRestart   bool     `long:"enable-auto-restart" description:"enables automatic restart by time. This can be overwritten by\nenvironment variable \"ENABLE_AUTO_RESTART\"." note:"unimplemented"`
 	OptAutoRestartInterval int      `long:"auto-restart-interval" arg:"seconds" description:"automatic restart interval (default 360). It is used with\n\"--enable-auto-restart\" option. This can be overwritten by environment\nvariable \"AUTO_RESTART_INTERVAL\"." note:"unimplemented"`
 	OptKillOldDelay        int      `long:"kill-old-delay" arg:"seconds" description:"time to suspend to send a signal to the old worker. The default value is\n5 when \"--enable-auto-restart\" is set, 0 otherwise. This can be\noverwritten by environment variable \"KILL_OLD_DELAY\"."`
@@ -35,22 +55,55 @@ type options struct {
 	OptVersion             bool     `long:"version" description:"prints the version number"`
 	OptDaemon              bool     `long:"daemon" description:"if set, run start_server as a daemon"`
 	OptSyslog              bool     `long:"syslog" description:"if set, prints log to syslog instead of stderr"`
-	OptSyslogPriority      string   `long:"syslog-priority" arg:"priority" description:"syslog priority. Specify one severity with one or more facilities\n(default: INFO,USER).\nPossible values are those on https://golang.org/pkg/log/syslog/#Priority\nwithout \"LOG_\" prefix."`
+	OptSyslogPriority      string   `long:"syslog-priority" arg:"priority" description:"syslog priority: a severity and a facility, separated by a comma, in\nany order (e.g. WARNING,LOCAL0). Either may be omitted (default: INFO,USER).\nPossible values are those on https://golang.org/pkg/log/syslog/#Priority,\ncase insensitive and with or without the \"LOG_\" prefix."`
+	OptSyslogAddr          string   `long:"syslog-addr" arg:"(udp|tcp|unix)://address" description:"if set, sends log to a syslog server instead of the local syslog daemon,\nformatted as per RFC5424 with the pid and generation of the worker as\nstructured data (e.g. udp://loghost:514, tcp://loghost:601,\nunix:///dev/log). Implies --syslog."`
+	OptSyslogTag           string   `long:"syslog-tag" arg:"tag" description:"tag (APP-NAME) of the messages sent to syslog (default: the name of\nthe program)"`
+	OptLogFormat           string   `long:"log-format" arg:"(text|json)" description:"format of the log printed to stderr or to --log-file. \"json\" prints one\nobject per line, with the time, level and message of each entry along with\nfields such as the pid and generation of the worker (default: text)"`
+	OptLogFile             string   `long:"log-file" arg:"filename" description:"if set, appends log to the file instead of printing it to stderr. The\nfile is rotated by start_server itself according to the options below,\nwhich also apply to the \"--worker-log\" file. On SIGUSR1, both files are\nreopened, for use with external log rotation."`
+	OptLogFileMaxSize      string   `long:"log-file-max-size" arg:"size" description:"rotates the log files when they would grow beyond this size, in bytes\nor with a K, M or G suffix (e.g. 100M) (default: 0, never)"`
+	OptLogFileRotate       int      `long:"log-file-rotate-interval" arg:"seconds" description:"rotates the log files after this many seconds (default: 0, never)"`
+	OptLogFileMaxBackups   int      `long:"log-file-max-backups" arg:"num" description:"number of rotated log files to keep, named with a \".1\", \".2\", ... suffix\n(default: 7)"`
 	logger                 logger.Logger
+	logRotation            logger.FileOptions
+	cli                    *options        // options as given on the command line
+	cliSet                 map[string]bool // long names of the options given on the command line
+	configCommand          []string        // server program and arguments from the configuration file
+	serviceName            string          // name of the service the options are for, if any
+	services               []starter.Service
 }
 
 func (o options) Args() []string          { return o.OptArgs }
 func (o options) Command() string         { return o.OptCommand }
 func (o options) Dir() string             { return o.OptDir }
+func (o options) Envdir() string          { return o.OptEnvdir }
+func (o options) EnvFiles() []string      { return o.OptEnvFiles }
+func (o options) RedactEnv() []string     { return o.OptRedactEnv }
 func (o options) Interval() time.Duration { return time.Duration(o.OptInterval) * time.Second }
+func (o options) RestartPolicy() string   { return o.OptRestartPolicy }
 func (o options) PidFile() string         { return o.OptPidFile }
 func (o options) Ports() []string         { return o.OptPorts }
 func (o options) Paths() []string         { return o.OptPaths }
 func (o options) SignalOnHUP() os.Signal  { return starter.SigFromName(o.OptSignalOnHUP) }
 func (o options) SignalOnTERM() os.Signal { return starter.SigFromName(o.OptSignalOnTERM) }
 func (o options) StatusFile() string      { return o.OptStatusFile }
+func (o options) WorkerLog() string       { return o.OptWorkerLog }
 func (o options) Logger() logger.Logger   { return o.logger }
 
+func (o options) LogRotation() logger.FileOptions { return o.logRotation }
+func (o options) MetricsAddr() string             { return o.OptMetricsAddr }
+func (o options) Rlimits() []string               { return o.OptRlimits }
+func (o options) Cgroup() string                  { return o.OptCgroup }
+func (o options) User() string                    { return o.OptUser }
+func (o options) Group() string                   { return o.OptGroup }
+func (o options) Groups() []string                { return o.OptGroups }
+func (o options) Chroot() string                  { return o.OptChroot }
+func (o options) Watchdog() string                { return o.OptWatchdog }
+func (o options) ChildSubreaper() bool            { return o.OptChildSubreaper }
+func (o options) SignalOnParentDeath() os.Signal  { return starter.SigFromName(o.OptSignalOnDeath) }
+func (o options) SystemdSockets() []string        { return o.OptSystemdSockets }
+func (o options) Services() []starter.Service     { return o.services }
+func (o options) ControlSocket() string           { return o.OptControl }
+
 func showHelp() {
 	// The ONLY reason we're not using go-flags' help option is
 	// because I wanted to tweak the format just a bit... but
@@ -62,6 +115,19 @@ Usage:
       # start Plack using Starlet listening at TCP port 8000
       start_server --port=8000 -- plackup -s Starlet --max-workers=100 index.psgi
 
+      # read the options, and the server program, from a file; the file is
+      # read again on SIGHUP
+      start_server --config=/path/to/app.toml
+
+      # run several services, and restart one of them
+      start_server --service=web=/path/to/web.toml --service=api=/path/to/api.toml \
+          --control=/path/to/control.sock
+      start_server --control=/path/to/control.sock --ctl="restart web"
+
+      # After installing a new start_server binary, send SIGUSR2 to make the
+      # running start_server re-exec itself without stopping the server program
+      kill -USR2 $(cat /path/to/pid-file)
+
 Options:
 `)
 
@@ -71,15 +137,34 @@ Options:
 	// compatible with the original start_server program
 	// (This is the order that the help is displayed in)
 	names := []string{
+		"OptConfig",
+		"OptServices",
+		"OptControl",
+		"OptCtl",
 		"OptPorts",
 		"OptPaths",
+		"OptSystemdSockets",
 		"OptDir",
+		"OptRestartPolicy",
 		"OptInterval",
 		"OptSignalOnHUP",
 		"OptSignalOnTERM",
 		"OptPidFile",
 		"OptStatusFile",
+		"OptUser",
+		"OptGroup",
+		"OptGroups",
+		"OptChroot",
+		"OptSignalOnDeath",
+		"OptChildSubreaper",
+		"OptWatchdog",
+		"OptRlimits",
+		"OptCgroup",
+		"OptMetricsAddr",
+		"OptWorkerLog",
 		"OptEnvdir",
+		"OptEnvFiles",
+		"OptRedactEnv",
 		"OptEnableAutoRestart",
 		"OptAutoRestartInterval",
 		"OptKillOldDelay",
@@ -89,6 +174,13 @@ Options:
 		"OptDaemon",
 		"OptSyslog",
 		"OptSyslogPriority",
+		"OptSyslogAddr",
+		"OptSyslogTag",
+		"OptLogFormat",
+		"OptLogFile",
+		"OptLogFileMaxSize",
+		"OptLogFileRotate",
+		"OptLogFileMaxBackups",
 	}
 
 	for _, name := range names {
@@ -118,29 +210,69 @@ Options:
 	}
 }
 
+// parseSize parses a number of bytes, optionally followed by K, M or G
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	mult := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size must not be negative")
+	}
+	return n * mult, nil
+}
+
 func childMain(args []string, opts *options) (st int) {
+	if len(opts.services) > 0 {
+		sv, err := starter.NewSupervisor(opts)
+		if err != nil {
+			opts.logger.Printf("error: %s", err)
+			return 1
+		}
+		if err := sv.Run(); err != nil {
+			return 1
+		}
+		return 0
+	}
+
 	opts.OptCommand = args[0]
 	if len(args) > 1 {
 		opts.OptArgs = args[1:]
 	}
 
-	if opts.OptEnvdir != "" {
-		os.Setenv("ENVDIR", opts.OptEnvdir)
-	}
-
 	s, err := starter.NewStarter(opts)
 	if err != nil {
 		opts.logger.Printf("error: %s", err)
 		return 1
 	}
-	s.Run()
+	if err := s.Run(); err != nil {
+		return 1
+	}
 	return 0
 }
 
 func main() {
 	opts := &options{
-		OptInterval:       -1,
-		OptSyslogPriority: "INFO,USER",
+		OptInterval:          -1,
+		OptSyslogPriority:    "INFO,USER",
+		OptLogFileMaxBackups: 7,
 	}
 	p := flags.NewParser(opts, flags.PrintErrors|flags.PassDoubleDash)
 	args, err := p.Parse()
@@ -154,12 +286,106 @@ func main() {
 		os.Exit(0)
 	}
 
+	if opts.OptConfig != "" {
+		opts.cliSet = setOnCommandLine(p)
+		cli := *opts
+		opts.cli = &cli
+		if err := opts.loadConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			args = opts.configCommand
+		}
+	}
+
+	if opts.OptCtl != "" {
+		if opts.OptControl == "" {
+			fmt.Fprintf(os.Stderr, "error: --ctl requires --control\n")
+			os.Exit(1)
+		}
+		reply, err := starter.Control(opts.OptControl, opts.OptCtl)
+		os.Stdout.WriteString(reply)
+		if err != nil {
+			if reply == "" {
+				fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if len(opts.OptServices) > 0 && len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "error: the server programs of services are given in their files\n")
+		os.Exit(1)
+	}
+	if opts.OptControl != "" && len(opts.OptServices) == 0 {
+		fmt.Fprintf(os.Stderr, "error: --control requires --service\n")
+		os.Exit(1)
+	}
+
+	if opts.OptSignalOnDeath != "" && starter.SigFromName(opts.OptSignalOnDeath) == nil {
+		fmt.Fprintf(os.Stderr, "error: unknown signal %s\n", opts.OptSignalOnDeath)
+		os.Exit(1)
+	}
+
 	if opts.OptInterval < 0 {
 		opts.OptInterval = 1
 	}
 
-	if opts.OptSyslog {
-		l, err := logger.NewSyslog(opts.OptSyslogPriority)
+	maxSize, err := parseSize(opts.OptLogFileMaxSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid --log-file-max-size: %s\n", err)
+		os.Exit(1)
+	}
+	opts.logRotation = logger.FileOptions{
+		MaxSize:        maxSize,
+		RotateInterval: time.Duration(opts.OptLogFileRotate) * time.Second,
+		MaxBackups:     opts.OptLogFileMaxBackups,
+	}
+
+	if opts.OptSyslogAddr != "" {
+		opts.OptSyslog = true
+	}
+
+	if opts.OptSyslog && opts.OptLogFile != "" {
+		fmt.Fprintf(os.Stderr, "error: --syslog and --log-file can not be used together\n")
+		os.Exit(1)
+	}
+
+	switch opts.OptLogFormat {
+	case "", "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown --log-format %q\n", opts.OptLogFormat)
+		os.Exit(1)
+	}
+	if opts.OptSyslog && opts.OptLogFormat == "json" {
+		fmt.Fprintf(os.Stderr, "error: --syslog and --log-format=json can not be used together\n")
+		os.Exit(1)
+	}
+
+	if opts.OptLogFile != "" {
+		l, err := logger.NewFile(opts.OptLogFile, opts.logRotation)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		if opts.OptLogFormat == "json" {
+			opts.logger = logger.NewJSON(l)
+		} else {
+			opts.logger = l
+		}
+	} else if opts.OptLogFormat == "json" {
+		opts.logger = logger.NewJSON(os.Stderr)
+	} else if opts.OptSyslogAddr != "" {
+		l, err := logger.NewRemoteSyslog(opts.OptSyslogAddr, opts.OptSyslogPriority, opts.OptSyslogTag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			os.Exit(1)
+		}
+		opts.logger = l
+	} else if opts.OptSyslog {
+		l, err := logger.NewTaggedSyslog(opts.OptSyslogPriority, opts.OptSyslogTag)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %s\n", err)
 			os.Exit(1)
@@ -169,12 +395,18 @@ func main() {
 		opts.logger = logger.NewStderr()
 	}
 
-	if len(args) == 0 {
+	if len(opts.OptServices) > 0 {
+		if err := opts.loadServices(); err != nil {
+			opts.logger.Printf("error: %s", err)
+			os.Exit(1)
+		}
+	} else if len(args) == 0 {
 		opts.logger.Printf("server program not specified")
 		os.Exit(1)
 	}
 
-	if opts.OptDaemon {
+	// A superdaemon upgrading itself is already detached
+	if opts.OptDaemon && !starter.Upgrading() {
 		ctx := new(daemon.Context)
 		child, err := ctx.Reborn()
 		if err != nil {
@@ -0,0 +1,186 @@
+package starter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+// controlTimeout bounds how long a control connection may take
+const controlTimeout = 10 * time.Second
+
+// controlRequest is a control command on its way to the main loop of
+// the Supervisor, which sends back the reply
+type controlRequest struct {
+	args  []string
+	reply chan string
+}
+
+// listenControl listens to the control socket at path, replacing a
+// socket left behind by a start_server that is gone
+func listenControl(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another start_server is listening to %s", path)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Anyone who can connect can stop the services
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// serveControl accepts one command per connection: a line of words,
+// the first of which is the command, answered with the reply
+func (sv *Supervisor) serveControl(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(controlTimeout))
+
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil && line == "" {
+				return
+			}
+			req := controlRequest{args: strings.Fields(line), reply: make(chan string, 1)}
+			select {
+			case sv.ctlCh <- req:
+			case <-sv.quit:
+				return
+			}
+			conn.Write([]byte(<-req.reply))
+		}()
+	}
+}
+
+// handleCommand runs a control command, and returns the reply to it.
+// Replies to failed commands start with "error: "
+func (sv *Supervisor) handleCommand(args []string, stopping bool) string {
+	if len(args) == 0 {
+		return "error: no command\n"
+	}
+
+	cmd, names := args[0], args[1:]
+	var svcs []*service
+	for _, name := range names {
+		svc := sv.findService(name)
+		if svc == nil {
+			return fmt.Sprintf("error: no such service %s\n", name)
+		}
+		svcs = append(svcs, svc)
+	}
+
+	switch cmd {
+	case "status":
+		if len(svcs) == 0 {
+			svcs = sv.services
+		}
+		var b []byte
+		for _, svc := range svcs {
+			b = append(b, svc.statusLine()...)
+			b = append(b, '\n')
+		}
+		return string(b)
+	case "start", "stop", "restart":
+	default:
+		return fmt.Sprintf("error: unknown command %s\n", cmd)
+	}
+
+	if len(svcs) == 0 {
+		return fmt.Sprintf("error: %s needs the name of a service\n", cmd)
+	}
+	if stopping && cmd != "stop" {
+		return "error: start_server is stopping\n"
+	}
+
+	var b []byte
+	for _, svc := range svcs {
+		b = append(b, sv.controlService(cmd, svc)...)
+		b = append(b, '\n')
+	}
+	return string(b)
+}
+
+func (sv *Supervisor) controlService(cmd string, svc *service) string {
+	switch cmd {
+	case "start":
+		if svc.state == serviceRunning || svc.state == serviceStopping {
+			return fmt.Sprintf("error: %s is %s", svc.name, svc.state)
+		}
+	case "stop":
+		if svc.state != serviceRunning {
+			return fmt.Sprintf("error: %s is not running", svc.name)
+		}
+		sv.logger.Log(logger.Notice, fmt.Sprintf("stopping service %s", svc.name))
+		svc.state = serviceStopping
+		sv.signalService(svc, syscall.SIGTERM)
+		return fmt.Sprintf("%s stopping", svc.name)
+	case "restart":
+		if svc.state == serviceStopping {
+			return fmt.Sprintf("error: %s is stopping", svc.name)
+		}
+		if svc.state == serviceRunning {
+			// Replaces the workers gracefully, as SIGHUP does
+			sv.logger.Log(logger.Notice, fmt.Sprintf("restarting service %s", svc.name))
+			sv.signalService(svc, syscall.SIGHUP)
+			return fmt.Sprintf("%s restarting", svc.name)
+		}
+	}
+
+	sv.logger.Log(logger.Notice, fmt.Sprintf("starting service %s", svc.name))
+	if err := sv.startService(svc); err != nil {
+		svc.state = serviceFailed
+		svc.err = err
+		return fmt.Sprintf("error: failed to start %s: %s", svc.name, err)
+	}
+	return fmt.Sprintf("%s starting", svc.name)
+}
+
+// errControlFailed is returned by Control along with the reply when the
+// command failed for any of the services
+var errControlFailed = errors.New("control command failed")
+
+// Control sends a control command, such as "status" or "restart web",
+// to the start_server listening to the control socket at path, and
+// returns its reply
+func Control(path string, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		return "", err
+	}
+	reply, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(string(reply), "error: ") || strings.Contains(string(reply), "\nerror: ") {
+		return string(reply), errControlFailed
+	}
+	return string(reply), nil
+}
@@ -0,0 +1,79 @@
+package starter
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// credentials are the user and groups the workers run as, when they
+// differ from ours
+type credentials struct {
+	set    bool
+	uid    int
+	gid    int
+	groups []int
+}
+
+// lookupCredentials resolves the names (or numeric ids) of the user, the
+// primary group and the supplementary groups the workers run as. The
+// groups default to those of the user
+func lookupCredentials(userName, groupName string, groupNames []string) (credentials, error) {
+	c := credentials{uid: os.Getuid(), gid: os.Getgid()}
+	if userName == "" && groupName == "" && len(groupNames) == 0 {
+		return c, nil
+	}
+	c.set = true
+
+	var u *user.User
+	if userName != "" {
+		var err error
+		if _, nerr := strconv.Atoi(userName); nerr == nil {
+			u, err = user.LookupId(userName)
+		} else {
+			u, err = user.Lookup(userName)
+		}
+		if err != nil {
+			if id, nerr := strconv.Atoi(userName); nerr == nil && groupName != "" {
+				// A uid without a passwd entry is fine, as long as we
+				// don't need to know its group
+				c.uid = id
+				u = nil
+			} else {
+				return c, fmt.Errorf("unknown user %s: %s", userName, err)
+			}
+		} else {
+			if c.uid, err = strconv.Atoi(u.Uid); err != nil {
+				return c, fmt.Errorf("user %s has a non numeric uid %s", userName, u.Uid)
+			}
+			if c.gid, err = strconv.Atoi(u.Gid); err != nil {
+				return c, fmt.Errorf("user %s has a non numeric gid %s", userName, u.Gid)
+			}
+		}
+	}
+
+	if groupName != "" {
+		gid, err := lookupGid(groupName)
+		if err != nil {
+			return c, fmt.Errorf("unknown group %s: %s", groupName, err)
+		}
+		c.gid = gid
+	}
+
+	if groupNames == nil && u != nil {
+		ids, err := u.GroupIds()
+		if err != nil {
+			return c, fmt.Errorf("failed to list the groups of user %s: %s", userName, err)
+		}
+		groupNames = ids
+	}
+	for _, name := range groupNames {
+		gid, err := lookupGid(name)
+		if err != nil {
+			return c, fmt.Errorf("unknown group %s: %s", name, err)
+		}
+		c.groups = append(c.groups, gid)
+	}
+	return c, nil
+}
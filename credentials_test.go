@@ -0,0 +1,43 @@
+package starter
+
+import (
+	"os/user"
+	"testing"
+)
+
+func TestLookupCredentials(t *testing.T) {
+	c, err := lookupCredentials("", "", nil)
+	if err != nil || c.set {
+		t.Errorf("Expected no credentials, got %#v (%v)", c, err)
+	}
+
+	if _, err := user.LookupId("0"); err != nil {
+		t.Skip("No passwd entry for root")
+	}
+
+	c, err = lookupCredentials("root", "", nil)
+	if err != nil {
+		t.Fatalf("lookupCredentials failed: %s", err)
+	}
+	if !c.set || c.uid != 0 || c.gid != 0 {
+		t.Errorf("Expected uid 0 gid 0, got %#v", c)
+	}
+
+	c, err = lookupCredentials("0", "12345", []string{"0", "23456"})
+	if err != nil {
+		t.Fatalf("lookupCredentials failed: %s", err)
+	}
+	if c.uid != 0 || c.gid != 12345 || len(c.groups) != 2 || c.groups[1] != 23456 {
+		t.Errorf("Unexpected credentials %#v", c)
+	}
+
+	// A uid without passwd entry needs an explicit group
+	if _, err := lookupCredentials("54321", "54321", nil); err != nil {
+		t.Errorf("lookupCredentials failed: %s", err)
+	}
+	for _, name := range []string{"no-such-user-hopefully", "54321"} {
+		if _, err := lookupCredentials(name, "", nil); err == nil {
+			t.Errorf("Expected user %s to be rejected", name)
+		}
+	}
+}
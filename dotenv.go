@@ -0,0 +1,169 @@
+package starter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+var reEnvFileName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// envFileError points at the offending line of an env file
+type envFileError struct {
+	path string
+	line int
+	msg  string
+}
+
+func (e *envFileError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.path, e.line, e.msg)
+}
+
+// loadEnvFile reads a dotenv style file into env. The format is
+//
+//	# comment
+//	KEY=value           # unquoted: trimmed, may end with a comment
+//	export KEY=value    # "export" prefix is accepted and ignored
+//	KEY='literal $text' # single quotes: taken as is, may span lines
+//	KEY="a\tb ${HOME}"  # double quotes: backslash escapes, may span lines
+//
+// ${VAR} and $VAR are expanded in unquoted and double quoted values,
+// using the variables in env (including those set earlier in the file).
+// Unknown variables expand to the empty string
+func loadEnvFile(path string, env map[string]string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.Replace(string(buf), "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineno := i + 1
+		errorf := func(format string, args ...interface{}) error {
+			return &envFileError{path: path, line: lineno, msg: fmt.Sprintf(format, args...)}
+		}
+
+		line := strings.TrimLeft(lines[i], " \t")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimLeft(line[len("export"):], " \t")
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return errorf("expected KEY=VALUE")
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !reEnvFileName.MatchString(key) {
+			return errorf("invalid variable name '%s'", key)
+		}
+
+		raw := strings.TrimLeft(line[eq+1:], " \t")
+		var value string
+		if raw != "" && (raw[0] == '\'' || raw[0] == '"') {
+			q := raw[0]
+			end := closingQuote(raw, q)
+			for end < 0 {
+				i++
+				if i >= len(lines) {
+					return errorf("unterminated %c quote", q)
+				}
+				raw += "\n" + lines[i]
+				end = closingQuote(raw, q)
+			}
+
+			if rest := strings.TrimSpace(raw[end+1:]); rest != "" && rest[0] != '#' {
+				return errorf("unexpected '%s' after closing quote", rest)
+			}
+
+			value = raw[1:end]
+			if q == '"' {
+				value, err = expandEnv(value, env, true)
+			}
+		} else {
+			for _, sep := range []string{" #", "\t#"} {
+				if i := strings.Index(raw, sep); i >= 0 {
+					raw = raw[:i]
+				}
+			}
+			value, err = expandEnv(strings.TrimSpace(raw), env, false)
+		}
+		if err != nil {
+			return errorf("%s", err)
+		}
+
+		env[key] = value
+	}
+	return nil
+}
+
+// closingQuote returns the index of the quote closing the one at s[0],
+// or -1. Backslashes only escape within double quotes
+func closingQuote(s string, q byte) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if q == '"' {
+				i++
+			}
+		case q:
+			return i
+		}
+	}
+	return -1
+}
+
+var envFileEscapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'"':  '"',
+	'\\': '\\',
+	'$':  '$',
+}
+
+// expandEnv replaces ${VAR} and $VAR in s. If escapes is true, backslash
+// escapes are processed as well
+func expandEnv(s string, env map[string]string, escapes bool) (string, error) {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && escapes && i+1 < len(s):
+			i++
+			if e, ok := envFileEscapes[s[i]]; ok {
+				b = append(b, e)
+			} else {
+				b = append(b, '\\', s[i])
+			}
+		case c == '$' && i+1 < len(s) && s[i+1] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in '%s'", s)
+			}
+			name := s[i+2 : i+end]
+			if !reEnvFileName.MatchString(name) {
+				return "", fmt.Errorf("invalid variable name '%s' in '%s'", name, s)
+			}
+			b = append(b, env[name]...)
+			i += end
+		case c == '$':
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || 'A' <= s[j] && s[j] <= 'Z' || 'a' <= s[j] && s[j] <= 'z' || j > i+1 && '0' <= s[j] && s[j] <= '9') {
+				j++
+			}
+			if j == i+1 {
+				b = append(b, c)
+				continue
+			}
+			b = append(b, env[s[i+1:j]]...)
+			i = j - 1
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b), nil
+}
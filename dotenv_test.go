@@ -0,0 +1,73 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func writeEnvFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %s", err)
+	}
+	defer f.Close()
+	f.WriteString(content)
+	return f.Name()
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	fn := writeEnvFile(t, `# a comment
+PLAIN=value
+  SPACED =   trimmed value   # trailing comment
+export EXPORTED=yes
+SINGLE='literal ${HOME} \n'
+DOUBLE="tab\tnewline\n ${PLAIN} $EXPORTED \$PLAIN"
+MULTI="first
+second"
+REF=${BASE}/bin:$PLAIN
+EMPTY=
+HASH=a#b
+`)
+	defer os.Remove(fn)
+
+	env := map[string]string{"BASE": "/usr"}
+	if err := loadEnvFile(fn, env); err != nil {
+		t.Fatalf("loadEnvFile failed: %s", err)
+	}
+
+	expect := map[string]string{
+		"BASE":     "/usr",
+		"PLAIN":    "value",
+		"SPACED":   "trimmed value",
+		"EXPORTED": "yes",
+		"SINGLE":   `literal ${HOME} \n`,
+		"DOUBLE":   "tab\tnewline\n value yes $PLAIN",
+		"MULTI":    "first\nsecond",
+		"REF":      "/usr/bin:value",
+		"EMPTY":    "",
+		"HASH":     "a#b",
+	}
+	if !reflect.DeepEqual(env, expect) {
+		t.Errorf("Expected %#v, got %#v", expect, env)
+	}
+}
+
+func TestLoadEnvFileErrors(t *testing.T) {
+	bad := []string{
+		"NOEQUALS\n",
+		"1BAD=name\n",
+		"OPEN='unterminated\n",
+		"TRAILING=\"quoted\" junk\n",
+		"BRACE=${UNTERMINATED\n",
+	}
+	for _, content := range bad {
+		fn := writeEnvFile(t, content)
+		err := loadEnvFile(fn, map[string]string{})
+		os.Remove(fn)
+		if _, ok := err.(*envFileError); !ok {
+			t.Errorf("Expected an envFileError for %q, got %#v", content, err)
+		}
+	}
+}
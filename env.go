@@ -1,65 +1,195 @@
 package starter
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/lestrrat/go-server-starter/logger"
 )
 
 var errNoEnv = errors.New("no ENVDIR specified, or ENVDIR does not exist")
 
-func reloadEnv() (map[string]string, error) {
-	dn := os.Getenv("ENVDIR")
+// superdaemonEnvVars are meant for start_server itself, and are never
+// passed on to the workers
+var superdaemonEnvVars = []string{
+	"LISTEN_PID",
+	"LISTEN_FDS",
+	"LISTEN_FDNAMES",
+	UpgradeStateEnvVarName,
+}
+
+// UpgradeStateEnvVarName is the environment variable used to pass the
+// state of the superdaemon across an upgrade
+const UpgradeStateEnvVarName = "SERVER_STARTER_UPGRADE_STATE"
+
+// baseEnv takes a snapshot of the environment of this process, which
+// every generation's environment is built from
+func baseEnv() map[string]string {
+	m := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			m[kv[:i]] = kv[i+1:]
+		}
+	}
+	for _, k := range superdaemonEnvVars {
+		delete(m, k)
+	}
+	return m
+}
+
+// setEnvdir points ENVDIR of the base environment at dir, or back at
+// the ENVDIR start_server was started with when dir is empty
+func setEnvdir(env map[string]string, dir string) {
+	if dir == "" {
+		dir = os.Getenv("ENVDIR")
+	}
+	if dir == "" {
+		delete(env, "ENVDIR")
+		return
+	}
+	env["ENVDIR"] = dir
+}
+
+// loadEnv builds the environment for the next generation from the base
+// environment, ENVDIR, and then the env files in the order given. The
+// environment of the superdaemon itself is never modified, so variables
+// removed from ENVDIR disappear from the next generation. If anything
+// can't be read or parsed, the environment of the previous generation
+// is kept
+func (s *Starter) loadEnv() error {
+	env, err := s.buildEnv(s.baseEnv, s.envFiles)
+	if err != nil {
+		return err
+	}
+	s.env = env
+	return nil
+}
+
+// buildEnv returns the environment made of base, the ENVDIR it points
+// at, and then envFiles
+func (s *Starter) buildEnv(base map[string]string, envFiles []string) (map[string]string, error) {
+	env := make(map[string]string, len(base))
+	for k, v := range base {
+		env[k] = v
+	}
+
+	if dn := env["ENVDIR"]; dn != "" {
+		m, unset, err := reloadEnv(dn, s.logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load from envdir: %s", err)
+		}
+		for k, v := range m {
+			env[k] = v
+		}
+		for _, k := range unset {
+			delete(env, k)
+		}
+	}
+
+	for _, fn := range envFiles {
+		if err := loadEnvFile(fn, env); err != nil {
+			return nil, fmt.Errorf("failed to load env file: %s", err)
+		}
+	}
+	return env, nil
+}
+
+// workerEnviron returns the environment for the worker about to be
+// started, in the form expected by exec.Cmd.Env
+func (s *Starter) workerEnviron() []string {
+	env := make([]string, 0, len(s.env)+2)
+	for k, v := range s.env {
+		if k == "SERVER_STARTER_PORT" || k == "SERVER_STARTER_GENERATION" {
+			continue
+		}
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+
+	return append(env,
+		"SERVER_STARTER_PORT="+s.portsEnv(),
+		fmt.Sprintf("SERVER_STARTER_GENERATION=%d", s.generation),
+	)
+}
+
+// portsEnv returns the value of SERVER_STARTER_PORT for the workers
+func (s *Starter) portsEnv() string {
+	ports := make([]string, 0, len(s.listeners))
+	for i, l := range s.listeners {
+		// file descriptor numbers in ExtraFiles turn out to be
+		// index + 3
+		if l.listener != nil {
+			ports = append(ports, fmt.Sprintf("%s=%d", l.spec, i+3))
+		}
+	}
+	return strings.Join(ports, ";")
+}
+
+// reloadEnv reads the directory dn following the rules of
+// envdir(8) from daemontools: each file names a variable, and its first
+// line, with trailing spaces and tabs removed and NULs turned into
+// newlines, is the value. An empty file means the variable is to be
+// removed. Files whose names start with a dot are ignored.
+//
+// It returns the variables to set and the names of the ones to unset.
+// Files that cannot be read are reported through l, and skipped
+func reloadEnv(dn string, l logger.Logger) (map[string]string, []string, error) {
 	if dn == "" {
-		return nil, errNoEnv
+		return nil, nil, errNoEnv
 	}
 
 	fi, err := os.Stat(dn)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if !fi.IsDir() {
-		return nil, err
+		return nil, nil, fmt.Errorf("%s is not a directory", dn)
 	}
 
-	var m map[string]string
+	entries, err := ioutil.ReadDir(dn)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	filepath.Walk(dn, func(path string, fi os.FileInfo, err error) error {
-		// Ignore errors
-		if err != nil {
-			return nil
+	m := make(map[string]string)
+	var unset []string
+	for _, fi := range entries {
+		envName := fi.Name()
+		if strings.HasPrefix(envName, ".") || fi.IsDir() {
+			continue
 		}
 
-		// Don't go into directories
-		if fi.IsDir() && dn != path {
-			return filepath.SkipDir
+		path := filepath.Join(dn, envName)
+		if strings.IndexByte(envName, '=') >= 0 {
+			l.Printf("envdir: ignoring %s: variable names may not contain '='", path)
+			continue
 		}
 
-		f, err := os.Open(path)
+		buf, err := ioutil.ReadFile(path)
 		if err != nil {
-			return nil
-		}
-		defer f.Close()
-
-		envName := filepath.Base(path)
-		scanner := bufio.NewScanner(f)
-		if scanner.Scan() {
-			if m == nil {
-				m = make(map[string]string)
-			}
-			l := scanner.Text()
-			m[envName] = strings.TrimSpace(l)
+			l.Printf("envdir: failed to read %s: %s", path, err)
+			continue
 		}
 
-		return nil
-	})
+		if len(buf) == 0 {
+			unset = append(unset, envName)
+			continue
+		}
 
-	if m == nil {
-		return nil, errNoEnv
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			buf = buf[:i]
+		}
+		buf = bytes.TrimRight(buf, " \t")
+		buf = bytes.Replace(buf, []byte{0}, []byte{'\n'}, -1)
+		m[envName] = string(buf)
 	}
 
-	return m, nil
+	return m, unset, nil
 }
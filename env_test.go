@@ -1,11 +1,17 @@
 package starter
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/lestrrat/go-server-starter/logger"
 )
 
 func TestEnvdir(t *testing.T) {
@@ -35,20 +41,9 @@ func TestEnvdir(t *testing.T) {
 		io.WriteString(f, fn)
 		f.Close()
 		closed = true
-
-		// save old values and restore later, if any
-		if old := os.Getenv(fn); old != "" {
-			os.Setenv(fn, "")
-			defer os.Setenv(fn, old)
-		}
-	}
-
-	if old := os.Getenv("ENVDIR"); old != "" {
-		defer os.Setenv("ENVDIR", old)
 	}
 
-	os.Setenv("ENVDIR", dir)
-	m, err := reloadEnv()
+	m, _, err := reloadEnv(dir, logger.NewStderr())
 	if err != nil {
 		t.Errorf("reloadEnv failed: %s", err)
 		return
@@ -57,7 +52,7 @@ func TestEnvdir(t *testing.T) {
 	for _, fn := range files {
 		v, ok := m[fn]
 		if !ok {
-			t.Errorf("Expected environment variable '%s' to exist")
+			t.Errorf("Expected environment variable '%s' to exist", fn)
 			return
 		}
 		if v != fn {
@@ -66,3 +61,159 @@ func TestEnvdir(t *testing.T) {
 		}
 	}
 }
+
+type bufferLogger []string
+
+func (l *bufferLogger) Printf(f string, args ...interface{}) {
+	*l = append(*l, fmt.Sprintf(f, args...))
+}
+
+func TestEnvdirSemantics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Errorf("Failed to create tempdir: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"TRAILING":  "  value \t \nsecond line\n",
+		"NUL":       "multi\x00line",
+		"EMPTY":     "",
+		"BLANKLINE": "\n",
+		".hidden":   "ignored",
+	}
+	for fn, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, fn), []byte(content), 0644); err != nil {
+			t.Errorf("Failed to create file '%s': %s", fn, err)
+			return
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "SUBDIR"), 0755); err != nil {
+		t.Errorf("Failed to create directory: %s", err)
+		return
+	}
+	// A dangling symlink can't be read, and must be reported
+	if err := os.Symlink(filepath.Join(dir, "nonexistent"), filepath.Join(dir, "BROKEN")); err != nil {
+		t.Errorf("Failed to create symlink: %s", err)
+		return
+	}
+
+	var l bufferLogger
+	m, unset, err := reloadEnv(dir, &l)
+	if err != nil {
+		t.Errorf("reloadEnv failed: %s", err)
+		return
+	}
+
+	expect := map[string]string{
+		"TRAILING":  "  value",
+		"NUL":       "multi\nline",
+		"BLANKLINE": "",
+	}
+	if !reflect.DeepEqual(m, expect) {
+		t.Errorf("Expected %#v, got %#v", expect, m)
+	}
+	if !reflect.DeepEqual(unset, []string{"EMPTY"}) {
+		t.Errorf("Expected EMPTY to be unset, got %#v", unset)
+	}
+	if len(l) != 1 {
+		t.Errorf("Expected the broken symlink to be logged, got %#v", l)
+	}
+
+	if _, _, err := reloadEnv(filepath.Join(dir, "TRAILING"), &l); err == nil {
+		t.Errorf("Expected reloadEnv to fail when ENVDIR is not a directory")
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Errorf("Failed to create tempdir: %s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Starter{
+		baseEnv: map[string]string{"ENVDIR": dir, "FOO": "base", "BAR": "base"},
+		logger:  logger.Leveled(logger.NewStderr()),
+	}
+
+	fn := filepath.Join(dir, "FOO")
+	ioutil.WriteFile(fn, []byte("envdir"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "BAR"), nil, 0644)
+	if err := s.loadEnv(); err != nil {
+		t.Errorf("loadEnv failed: %s", err)
+		return
+	}
+	if s.env["FOO"] != "envdir" {
+		t.Errorf("Expected FOO to be taken from envdir, got '%s'", s.env["FOO"])
+	}
+	if _, ok := s.env["BAR"]; ok {
+		t.Errorf("Expected BAR to be removed by its empty file")
+	}
+	if os.Getenv("FOO") != "" {
+		t.Errorf("Expected the environment of the superdaemon to be left alone")
+	}
+
+	// Removing the file brings back the original value in the next
+	// generation
+	os.Remove(fn)
+	if err := s.loadEnv(); err != nil {
+		t.Errorf("loadEnv failed: %s", err)
+		return
+	}
+	if s.env["FOO"] != "base" {
+		t.Errorf("Expected FOO to be back to 'base', got '%s'", s.env["FOO"])
+	}
+}
+
+func TestRunWithBrokenEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The worker still starts, with the environment start_server got
+	s, err := NewStarter(&config{command: "true", restart: "never", envfiles: []string{filepath.Join(dir, "missing.env")}})
+	if err != nil {
+		t.Fatalf("Failed to create starter: %s", err)
+	}
+	s.signals = make(chan os.Signal, 1)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected Run to start the worker anyway, got %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		s.signals <- syscall.SIGTERM
+		t.Errorf("Timed out waiting for the worker")
+	}
+}
+
+func TestLogEnvDiff(t *testing.T) {
+	var l bufferLogger
+	s := &Starter{
+		logger:    logger.Leveled(&l),
+		redactEnv: defaultEnvRedactPatterns,
+	}
+
+	prev := map[string]string{"KEEP": "1", "GONE": "1", "PATH": "/bin", "DB_PASSWORD": "old"}
+	next := map[string]string{"KEEP": "1", "NEW": "1", "PATH": "/usr/bin", "DB_PASSWORD": "new", "api_key": "k"}
+	s.logEnvDiff(prev, next, 2)
+
+	expect := bufferLogger{
+		"generation 2: env changed DB_PASSWORD from <redacted> to <redacted>",
+		"generation 2: env removed GONE",
+		"generation 2: env added NEW=1",
+		"generation 2: env changed PATH from /bin to /usr/bin",
+		"generation 2: env added api_key=<redacted>",
+	}
+	if !reflect.DeepEqual(l, expect) {
+		t.Errorf("Expected %#v, got %#v", expect, l)
+	}
+}
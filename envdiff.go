@@ -0,0 +1,61 @@
+package starter
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+// defaultEnvRedactPatterns are used when the Config doesn't specify any
+var defaultEnvRedactPatterns = []string{"*SECRET*", "*PASSWORD*", "*TOKEN*", "*KEY*"}
+
+// redacted returns true if the value of the variable name must not be
+// logged. Patterns are shell globs, matched case insensitively
+func (s *Starter) redacted(name string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range s.redactEnv {
+		if ok, _ := path.Match(strings.ToUpper(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Starter) envValue(name, value string) string {
+	if s.redacted(name) {
+		return "<redacted>"
+	}
+	return value
+}
+
+// logEnvDiff logs the variables that were added, removed or changed
+// between the environment of the running generation and the one about
+// to be started
+func (s *Starter) logEnvDiff(prev, next map[string]string, generation int) {
+	keys := make([]string, 0, len(prev)+len(next))
+	for k := range prev {
+		keys = append(keys, k)
+	}
+	for k := range next {
+		if _, ok := prev[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		ov, inPrev := prev[k]
+		nv, inNext := next[k]
+		switch {
+		case !inPrev:
+			s.logger.Log(logger.Info, fmt.Sprintf("generation %d: env added %s=%s", generation, k, s.envValue(k, nv)), logger.F("generation", generation))
+		case !inNext:
+			s.logger.Log(logger.Info, fmt.Sprintf("generation %d: env removed %s", generation, k), logger.F("generation", generation))
+		case ov != nv:
+			s.logger.Log(logger.Info, fmt.Sprintf("generation %d: env changed %s from %s to %s", generation, k, s.envValue(k, ov), s.envValue(k, nv)), logger.F("generation", generation))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestListenAllAbstract(t *testing.T) {
+	path := fmt.Sprintf("@listener-test-%d", os.Getpid())
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer l.Close()
+
+	f, err := l.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatalf("Failed to get file from listener: %s", err)
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatalf("Failed to dup fd: %s", err)
+	}
+
+	os.Setenv("SERVER_STARTER_PORT", fmt.Sprintf("%s=%d", path, fd))
+	ports, err := Ports()
+	if err != nil {
+		t.Fatalf("Failed to parse ports from env: %s", err)
+	}
+	if ul, ok := ports[0].(UnixListener); !ok || !ul.Abstract() {
+		t.Errorf("Expected an abstract UnixListener, got %#v", ports[0])
+	}
+
+	listeners, err := ListenAll()
+	if err != nil {
+		t.Fatalf("ListenAll failed: %s", err)
+	}
+	for _, l := range listeners {
+		l.Close()
+	}
+}
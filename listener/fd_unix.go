@@ -0,0 +1,77 @@
+// +build !windows
+
+package listener
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// checkFd makes sure that the file descriptor behind l is an open socket
+// in listening state, bound to the address l claims it is. Only
+// non-blocking calls (fstat, getsockopt, getsockname) are used
+func checkFd(l Listener) error {
+	fd := int(l.Fd())
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return err
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFSOCK {
+		return ErrNotSocket
+	}
+
+	accepting, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+	if err != nil {
+		return err
+	}
+	if accepting == 0 {
+		return ErrNotListening
+	}
+
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		return err
+	}
+
+	switch l := l.(type) {
+	case TCPListener:
+		var ip net.IP
+		var port int
+		switch sa := sa.(type) {
+		case *syscall.SockaddrInet4:
+			ip, port = net.IP(sa.Addr[:]), sa.Port
+		case *syscall.SockaddrInet6:
+			ip, port = net.IP(sa.Addr[:]), sa.Port
+		default:
+			return &AddrMismatchError{Declared: l.declared(), Actual: "a non-TCP socket"}
+		}
+
+		actual := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+		if port != l.Port {
+			return &AddrMismatchError{Declared: l.declared(), Actual: actual}
+		}
+		// "0.0.0.0" is what a bare port spec parses to, so it matches
+		// whatever the socket is bound to. Host names can't be checked
+		// without a lookup, so only literal addresses are compared
+		if l.Addr != "0.0.0.0" {
+			if want := net.ParseIP(l.Addr); want != nil && !want.Equal(ip) {
+				return &AddrMismatchError{Declared: l.declared(), Actual: actual}
+			}
+		}
+	case UnixListener:
+		su, ok := sa.(*syscall.SockaddrUnix)
+		if !ok {
+			return &AddrMismatchError{Declared: l.Path, Actual: "a non-unix socket"}
+		}
+		if su.Name != l.Path {
+			return &AddrMismatchError{Declared: l.Path, Actual: su.Name}
+		}
+	}
+	return nil
+}
+
+func (l TCPListener) declared() string {
+	return net.JoinHostPort(l.Addr, strconv.Itoa(l.Port))
+}
@@ -0,0 +1,86 @@
+// +build !windows
+
+package listener
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// dupListenerFd returns a raw copy of l's descriptor that is not owned
+// by any *os.File, so that ListenAll is free to close it
+func dupListenerFd(t *testing.T, l *net.TCPListener) int {
+	f, err := l.File()
+	if err != nil {
+		t.Fatalf("Failed to get file from listener: %s", err)
+	}
+	defer f.Close()
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to dup fd: %s", err)
+	}
+	return fd
+}
+
+func TestListenAll(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	fd := dupListenerFd(t, l.(*net.TCPListener))
+	os.Setenv("SERVER_STARTER_PORT", fmt.Sprintf("127.0.0.1:%d=%d", port, fd))
+	listeners, err := ListenAll()
+	if err != nil {
+		t.Fatalf("ListenAll failed: %s", err)
+	}
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	// The intermediate file must have been closed
+	if _, err := syscall.Dup(fd); err != syscall.EBADF {
+		t.Errorf("Expected fd %d to be closed after ListenAll", fd)
+	}
+}
+
+func TestListenAllInvalidFd(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+	fd := dupListenerFd(t, l.(*net.TCPListener))
+	defer syscall.Close(fd)
+
+	f, err := ioutil.TempFile("", "listener_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	os.Setenv("SERVER_STARTER_PORT", fmt.Sprintf("%d=%d;%s=%d", port+1, fd, f.Name(), f.Fd()))
+	_, err = ListenAll()
+	errs, ok := err.(ListenErrors)
+	if !ok {
+		t.Fatalf("Expected ListenErrors, got %#v", err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %d: %s", len(errs), errs)
+	}
+	if _, ok := errs[0].Err.(*AddrMismatchError); !ok {
+		t.Errorf("Expected AddrMismatchError for wrong port, got %#v", errs[0].Err)
+	}
+	if errs[1].Err != ErrNotSocket {
+		t.Errorf("Expected ErrNotSocket for regular file, got %#v", errs[1].Err)
+	}
+}
@@ -0,0 +1,7 @@
+package listener
+
+// checkFd is a no-op on windows, where descriptors can't be inspected
+// the way they are on unix
+func checkFd(l Listener) error {
+	return nil
+}
@@ -14,8 +14,45 @@ const ServerStarterEnvVarName = "SERVER_STARTER_PORT"
 
 var (
 	ErrNoListeningTarget = errors.New("No listening target")
+	ErrNotSocket         = errors.New("file descriptor is not a socket")
+	ErrNotListening      = errors.New("socket is not in listening state")
 )
 
+// ListenError describes why a single entry in SERVER_STARTER_PORT could
+// not be turned into a net.Listener
+type ListenError struct {
+	Target Listener
+	Err    error
+}
+
+func (e *ListenError) Error() string {
+	return fmt.Sprintf("invalid listen target '%s': %s", e.Target, e.Err)
+}
+
+// ListenErrors is returned by ListenAll when one or more entries in
+// SERVER_STARTER_PORT fail validation. It holds one *ListenError
+// per offending entry
+type ListenErrors []*ListenError
+
+func (errs ListenErrors) Error() string {
+	list := make([]string, len(errs))
+	for i, err := range errs {
+		list[i] = err.Error()
+	}
+	return strings.Join(list, "; ")
+}
+
+// AddrMismatchError is used when the socket behind a file descriptor
+// is bound to an address other than the one declared for it
+type AddrMismatchError struct {
+	Declared string
+	Actual   string
+}
+
+func (e *AddrMismatchError) Error() string {
+	return fmt.Sprintf("socket is bound to %s, not %s", e.Actual, e.Declared)
+}
+
 // Listener is the interface for things that listen on file descriptors
 // specified by Start::Server / server_starter
 type Listener interface {
@@ -45,7 +82,8 @@ type TCPListener struct {
 	fd   uintptr
 }
 
-// UnixListener is a listener for unix sockets.
+// UnixListener is a listener for unix sockets. A Path starting with '@'
+// refers to a socket in the Linux abstract namespace.
 type UnixListener struct {
 	Path string
 	fd   uintptr
@@ -55,7 +93,7 @@ func (l TCPListener) String() string {
 	if l.Addr == "0.0.0.0" {
 		return fmt.Sprintf("%d=%d", l.Port, l.fd)
 	}
-	return fmt.Sprintf("%s:%d=%d", l.Addr, l.Port, l.fd)
+	return fmt.Sprintf("%s=%d", net.JoinHostPort(l.Addr, strconv.Itoa(l.Port)), l.fd)
 }
 
 // Fd returns the underlying file descriptor
@@ -63,9 +101,12 @@ func (l TCPListener) Fd() uintptr {
 	return l.fd
 }
 
-// Listen creates a new Listener
+// Listen validates the file descriptor and creates a new Listener
 func (l TCPListener) Listen() (net.Listener, error) {
-	return net.FileListener(os.NewFile(l.Fd(), fmt.Sprintf("%s:%d", l.Addr, l.Port)))
+	if err := checkFd(l); err != nil {
+		return nil, &ListenError{Target: l, Err: err}
+	}
+	return fileListener(l.Fd(), fmt.Sprintf("%s:%d", l.Addr, l.Port))
 }
 
 func (l UnixListener) String() string {
@@ -77,13 +118,32 @@ func (l UnixListener) Fd() uintptr {
 	return l.fd
 }
 
-// Listen creates a new Listener
+// Abstract returns true if the socket lives in the Linux abstract
+// namespace rather than on the file system
+func (l UnixListener) Abstract() bool {
+	return strings.HasPrefix(l.Path, "@")
+}
+
+// Listen validates the file descriptor and creates a new Listener
 func (l UnixListener) Listen() (net.Listener, error) {
-	return net.FileListener(os.NewFile(l.Fd(), l.Path))
+	if err := checkFd(l); err != nil {
+		return nil, &ListenError{Target: l, Err: err}
+	}
+	return fileListener(l.Fd(), l.Path)
+}
+
+// fileListener creates a net.Listener from fd. net.FileListener dups the
+// descriptor, so the intermediate *os.File (and with it the original fd)
+// is closed before returning
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	defer f.Close()
+	return net.FileListener(f)
 }
 
-// Being lazy here...
-var reLooksLikeHostPort = regexp.MustCompile(`^(\d+):(\d+)$`)
+// Being lazy here... Unix paths may end in ":<digits>" too, so a host
+// never starts with '/' or '@', nor contains '/'
+var reLooksLikeHostPort = regexp.MustCompile(`^([^/@][^/]*):(\d+)$`)
 var reLooksLikePort = regexp.MustCompile(`^\d+$`)
 
 func parseListenTargets(str string) ([]Listener, error) {
@@ -95,22 +155,26 @@ func parseListenTargets(str string) ([]Listener, error) {
 	ret := make([]Listener, len(rawspec))
 
 	for i, pairString := range rawspec {
-		pair := strings.Split(pairString, "=")
-		hostPort := strings.TrimSpace(pair[0])
-		fdString := strings.TrimSpace(pair[1])
+		// Paths may contain '=', the fd never does
+		sep := strings.LastIndex(pairString, "=")
+		if sep < 0 {
+			return nil, fmt.Errorf("failed to parse '%s' as listen target: missing fd", pairString)
+		}
+		hostPort := strings.TrimSpace(pairString[:sep])
+		fdString := strings.TrimSpace(pairString[sep+1:])
 		fd, err := strconv.ParseUint(fdString, 10, 0)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse '%s' as listen target: %s", pairString, err)
 		}
 
-		if matches := reLooksLikeHostPort.FindAllString(hostPort, -1); matches != nil {
-			port, err := strconv.ParseInt(matches[1], 10, 0)
+		if matches := reLooksLikeHostPort.FindStringSubmatch(hostPort); matches != nil {
+			port, err := strconv.ParseInt(matches[2], 10, 0)
 			if err != nil {
 				return nil, err
 			}
 
 			ret[i] = TCPListener{
-				Addr: matches[0],
+				Addr: strings.Trim(matches[1], "[]"),
 				Port: int(port),
 				fd:   uintptr(fd),
 			}
@@ -148,13 +212,26 @@ func Ports() ([]Listener, error) {
 }
 
 // ListenAll parses environment variable SERVER_STARTER_PORT, and creates
-// net.Listener objects
+// net.Listener objects. Every file descriptor is checked before any of
+// them is used: if some are closed, are not listening sockets, or are
+// bound to an address other than the one declared in the environment,
+// ListenAll returns a ListenErrors holding one *ListenError per bad entry
 func ListenAll() ([]net.Listener, error) {
 	targets, err := parseListenTargets(GetPortsSpecification())
 	if err != nil {
 		return nil, err
 	}
 
+	var errs ListenErrors
+	for _, target := range targets {
+		if err := checkFd(target); err != nil {
+			errs = append(errs, &ListenError{Target: target, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	ret := make([]net.Listener, len(targets))
 	for i, target := range targets {
 		ret[i], err = target.Listen()
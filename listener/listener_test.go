@@ -37,3 +37,28 @@ func TestPortNoEnv(t *testing.T) {
 		t.Errorf("Ports must return nil if no env")
 	}
 }
+
+func TestPortHostPort(t *testing.T) {
+	os.Setenv("SERVER_STARTER_PORT", "127.0.0.1:9090=4;[::1]:8080=5;/tmp/foo:bar.sock=6;/run/app:8080=7;@app:8080=8")
+	ports, err := Ports()
+	if err != nil {
+		t.Errorf("Failed to parse ports from env: %s", err)
+		return
+	}
+
+	expect := []Listener{
+		TCPListener{Addr: "127.0.0.1", Port: 9090, fd: 4},
+		TCPListener{Addr: "::1", Port: 8080, fd: 5},
+		UnixListener{Path: "/tmp/foo:bar.sock", fd: 6},
+		UnixListener{Path: "/run/app:8080", fd: 7},
+		UnixListener{Path: "@app:8080", fd: 8},
+	}
+	if len(ports) != len(expect) {
+		t.Fatalf("Expected %d listeners, got %d", len(expect), len(ports))
+	}
+	for i, port := range ports {
+		if port != expect[i] {
+			t.Errorf("parsed listener is not what we expected (expected %#v, got %#v)", expect[i], port)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package starter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+// Reloader may be implemented by a Config whose settings can change
+// while start_server is running. When the Config given to NewStarter
+// implements it, Run calls Reload upon receiving SIGHUP, picks up the
+// signals, interval, envdir and env files of the Config it returns, and
+// then binds newly configured ports/paths and closes the ones that went
+// away before spawning the next generation. None of this happens if any
+// of it fails, and the Starter keeps using the current Config. Reload
+// must not change the Config it is called on
+type Reloader interface {
+	Reload() (Config, error)
+}
+
+type listener struct {
+	listener net.Listener
+	spec     string // path or port spec, as advertised to the workers
+	config   string // spec as configured, including socket options
+	adopted  bool   // passed in by systemd rather than bound by us
+}
+
+// listenerFile returns a dup of the listener's file descriptor
+func listenerFile(l net.Listener) (*os.File, error) {
+	switch l := l.(type) {
+	case *net.TCPListener:
+		return l.File()
+	case *net.UnixListener:
+		return l.File()
+	default:
+		return nil, fmt.Errorf("unknown listener type %T", l)
+	}
+}
+
+func parseListenSpecs(c Config) ([]portSpec, []pathSpec, error) {
+	ports := make([]portSpec, len(c.Ports()))
+	for i, addr := range c.Ports() {
+		ps, err := parsePortSpec(addr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse addr spec '%s': %s", addr, err)
+		}
+		ports[i] = ps
+	}
+
+	paths := make([]pathSpec, len(c.Paths()))
+	for i, path := range c.Paths() {
+		ps, err := parsePathSpec(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse path spec '%s': %s", path, err)
+		}
+		paths[i] = ps
+	}
+	return ports, paths, nil
+}
+
+func (s *Starter) bindPort(ps portSpec) (net.Listener, error) {
+	lc := net.ListenConfig{Control: ps.opts.control}
+	l, err := lc.Listen(context.Background(), ps.network(), ps.hostport())
+	if err != nil {
+		s.logger.Log(logger.Error, fmt.Sprintf("failed to listen to %s:%s", ps.hostport(), err))
+		return nil, err
+	}
+
+	if err := ps.opts.setBacklog(l); err != nil {
+		l.Close()
+		s.logger.Log(logger.Error, err.Error())
+		return nil, err
+	}
+	return l, nil
+}
+
+func (s *Starter) bindPath(ps pathSpec) (net.Listener, error) {
+	stale, err := ps.isStale()
+	if err != nil {
+		s.logger.Log(logger.Error, err.Error())
+		return nil, err
+	}
+	if stale {
+		s.logger.Log(logger.Warning, fmt.Sprintf("removing existing socket file:%s", ps.path))
+		if err := os.Remove(ps.path); err != nil {
+			s.logger.Log(logger.Error, fmt.Sprintf("failed to remove existing socket file:%s:%s", ps.path, err))
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", ps.path)
+	if err != nil {
+		s.logger.Log(logger.Error, fmt.Sprintf("failed to listen file:%s:%s", ps.path, err))
+		return nil, err
+	}
+	if err := ps.setPermissions(); err != nil {
+		l.Close()
+		s.logger.Log(logger.Error, fmt.Sprintf("failed to set permissions on socket file:%s:%s", ps.path, err))
+		return nil, err
+	}
+	return l, nil
+}
+
+// bindListeners creates the listeners for the configured ports and
+// paths. Sockets handed over by systemd socket activation are used
+// instead of binding when their address matches a configured spec, or
+// when their LISTEN_FDNAMES name is one of the configured systemd
+// sockets, and are passed on to the workers even if they match none
+func (s *Starter) bindListeners() error {
+	adopted, err := systemdListeners()
+	if err != nil {
+		s.logger.Log(logger.Error, fmt.Sprintf("failed to adopt systemd sockets: %s", err))
+		return err
+	}
+	for _, l := range adopted {
+		s.logger.Log(logger.Info, fmt.Sprintf("adopted systemd socket %s as %s", l.config, l.spec), logger.F("listener", l.spec))
+	}
+
+	// adopt returns the systemd socket listening at spec, if any
+	adopt := func(spec string) (listener, bool) {
+		for i, l := range adopted {
+			if l.spec == spec {
+				adopted = append(adopted[:i], adopted[i+1:]...)
+				return l, true
+			}
+		}
+		return listener{}, false
+	}
+
+	for i, ps := range s.ports {
+		if l, ok := adopt(ps.String()); ok {
+			s.listeners = append(s.listeners, l)
+			continue
+		}
+		l, err := s.bindPort(ps)
+		if err != nil {
+			return err
+		}
+		s.listeners = append(s.listeners, listener{listener: l, spec: ps.String(), config: s.config.Ports()[i]})
+	}
+
+	for i, ps := range s.paths {
+		if l, ok := adopt(ps.path); ok {
+			s.listeners = append(s.listeners, l)
+			continue
+		}
+		l, err := s.bindPath(ps)
+		if err != nil {
+			return err
+		}
+		s.listeners = append(s.listeners, listener{listener: l, spec: ps.path, config: s.config.Paths()[i]})
+	}
+
+	// Several sockets may share a name, e.g. the IPv4 and IPv6 ones
+	for _, name := range s.config.SystemdSockets() {
+		var rest []listener
+		found := false
+		for _, l := range adopted {
+			if l.config == name {
+				s.listeners = append(s.listeners, l)
+				found = true
+			} else {
+				rest = append(rest, l)
+			}
+		}
+		if !found {
+			err := fmt.Errorf("systemd socket %s was not passed to start_server", name)
+			s.logger.Log(logger.Error, err.Error())
+			return err
+		}
+		adopted = rest
+	}
+
+	s.listeners = append(s.listeners, adopted...)
+	return nil
+}
+
+// reloadListeners brings the set of listeners in line with what c asks
+// for. Listeners that are still wanted are left
+// untouched, and keep their slot so that their fd number in the next
+// generation stays the same. Slots of closed listeners are reused for
+// new ones. If any new listener cannot be bound, nothing is changed
+func (s *Starter) reloadListeners(c Config) error {
+	ports, paths, err := parseListenSpecs(c)
+	if err != nil {
+		return err
+	}
+
+	// Sockets from systemd are only passed in when we start
+	for _, name := range c.SystemdSockets() {
+		found := false
+		for _, l := range s.listeners {
+			found = found || l.adopted && l.config == name
+		}
+		if !found {
+			return fmt.Errorf("systemd socket %s was not passed to start_server", name)
+		}
+	}
+
+	wanted := make(map[string]bool)
+	var added []listener
+	fail := func(err error) error {
+		for _, l := range added {
+			l.listener.Close()
+		}
+		return err
+	}
+
+	current := make(map[string]listener)
+	for _, l := range s.listeners {
+		if l.listener != nil {
+			current[l.spec] = l
+		}
+	}
+
+	for i, ps := range ports {
+		spec := ps.String()
+		wanted[spec] = true
+		if l, ok := current[spec]; ok {
+			if !l.adopted && l.config != c.Ports()[i] {
+				s.logger.Log(logger.Warning, fmt.Sprintf("options for %s changed, they will not take effect until start_server is restarted", spec))
+			}
+			continue
+		}
+		l, err := s.bindPort(ps)
+		if err != nil {
+			return fail(err)
+		}
+		added = append(added, listener{listener: l, spec: spec, config: c.Ports()[i]})
+	}
+
+	for i, ps := range paths {
+		wanted[ps.path] = true
+		if l, ok := current[ps.path]; ok {
+			if !l.adopted && l.config != c.Paths()[i] {
+				s.logger.Log(logger.Warning, fmt.Sprintf("options for %s changed, they will not take effect until start_server is restarted", ps.path))
+			}
+			continue
+		}
+		l, err := s.bindPath(ps)
+		if err != nil {
+			return fail(err)
+		}
+		added = append(added, listener{listener: l, spec: ps.path, config: c.Paths()[i]})
+	}
+
+	// Sockets from systemd can't be bound again once closed, so they
+	// are kept around whether they are still configured or not
+	for i, l := range s.listeners {
+		if l.listener == nil || l.adopted || wanted[l.spec] {
+			continue
+		}
+		s.logger.Log(logger.Info, fmt.Sprintf("closing listener %s", l.spec), logger.F("listener", l.spec))
+		l.listener.Close()
+		s.listeners[i] = listener{}
+	}
+
+	for _, l := range added {
+		s.logger.Log(logger.Info, fmt.Sprintf("listening to %s", l.spec), logger.F("listener", l.spec))
+		s.addListener(l)
+	}
+
+	// Trailing empty slots don't need to be passed to the workers
+	for len(s.listeners) > 0 && s.listeners[len(s.listeners)-1].listener == nil {
+		s.listeners = s.listeners[:len(s.listeners)-1]
+	}
+
+	s.ports = ports
+	s.paths = paths
+	return nil
+}
+
+// addListener puts l in the first free slot, or appends it
+func (s *Starter) addListener(l listener) {
+	for i := range s.listeners {
+		if s.listeners[i].listener == nil {
+			s.listeners[i] = l
+			return
+		}
+	}
+	s.listeners = append(s.listeners, l)
+}
+
+// reload re-reads the configuration, if the Config supports it, and
+// prepares the next generation: its environment and listeners. The new
+// configuration is checked in full before any of it is applied, so that
+// a failure leaves the current one in place
+func (s *Starter) reload() error {
+	c := s.config
+	if r, ok := c.(Reloader); ok {
+		next, err := r.Reload()
+		if err != nil {
+			return err
+		}
+		c = next
+	}
+
+	signalOnHUP := os.Signal(syscall.SIGTERM)
+	if sig := c.SignalOnHUP(); sig != nil {
+		signalOnHUP = sig
+	}
+	signalOnTERM := os.Signal(syscall.SIGTERM)
+	if sig := c.SignalOnTERM(); sig != nil {
+		signalOnTERM = sig
+	}
+
+	base := make(map[string]string, len(s.baseEnv))
+	for k, v := range s.baseEnv {
+		base[k] = v
+	}
+	setEnvdir(base, c.Envdir())
+	env, err := s.buildEnv(base, c.EnvFiles())
+	if err != nil {
+		return err
+	}
+
+	// Last, as it only changes the listeners when it succeeds
+	if err := s.reloadListeners(c); err != nil {
+		return err
+	}
+
+	s.config = c
+	s.signalOnHUP = signalOnHUP
+	s.signalOnTERM = signalOnTERM
+	s.interval = c.Interval()
+	s.envFiles = c.EnvFiles()
+	s.baseEnv = base
+	s.env = env
+	return nil
+}
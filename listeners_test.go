@@ -0,0 +1,163 @@
+package starter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer l.Close()
+	return fmt.Sprintf("127.0.0.1:%d", l.Addr().(*net.TCPAddr).Port)
+}
+
+func TestReloadListeners(t *testing.T) {
+	p1, p2, p3 := freePort(t), freePort(t), freePort(t)
+
+	c := &config{
+		ports:   []string{p1, p2},
+		command: "true",
+	}
+	s, err := NewStarter(c)
+	if err != nil {
+		t.Fatalf("Failed to create starter: %s", err)
+	}
+	defer s.Teardown()
+
+	if err := s.bindListeners(); err != nil {
+		t.Fatalf("Failed to bind listeners: %s", err)
+	}
+	kept := s.listeners[1].listener
+
+	c.ports = []string{p2, p3}
+	if err := s.reloadListeners(c); err != nil {
+		t.Fatalf("Failed to reload listeners: %s", err)
+	}
+
+	if len(s.listeners) != 2 {
+		t.Fatalf("Expected 2 listener slots, got %d", len(s.listeners))
+	}
+	if s.listeners[0].spec != p3 {
+		t.Errorf("Expected new listener %s to reuse slot 0, got %s", p3, s.listeners[0].spec)
+	}
+	if s.listeners[1].listener != kept {
+		t.Errorf("Expected listener %s to be kept in slot 1", p2)
+	}
+	if _, err := net.Dial("tcp4", p1); err == nil {
+		t.Errorf("Expected %s to be closed", p1)
+	}
+
+	// A port that can't be bound must leave everything untouched
+	c.ports = []string{p2, p3, "127.0.0.1:1,nosuchopt"}
+	if err := s.reloadListeners(c); err == nil {
+		t.Errorf("Expected reload with a bad spec to fail")
+	}
+	if len(s.listeners) != 2 || s.listeners[1].listener != kept {
+		t.Errorf("Expected listeners to be left untouched after failed reload")
+	}
+
+	// Removing the last listener trims its slot
+	c.ports = []string{p3}
+	if err := s.reloadListeners(c); err != nil {
+		t.Fatalf("Failed to reload listeners: %s", err)
+	}
+	if len(s.listeners) != 1 || s.listeners[0].spec != p3 {
+		t.Errorf("Expected only %s to remain, got %#v", p3, s.listeners)
+	}
+
+	// Sockets from systemd can only be named if they were passed in
+	c.sdsockets = []string{"web"}
+	if err := s.reloadListeners(c); err == nil {
+		t.Errorf("Expected reload with a systemd socket that was not passed in to fail")
+	}
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	s.listeners = append(s.listeners, listener{listener: l, spec: l.Addr().String(), config: "web", adopted: true})
+	if err := s.reloadListeners(c); err != nil {
+		t.Fatalf("Failed to reload listeners: %s", err)
+	}
+	if len(s.listeners) != 2 || s.listeners[1].listener != l {
+		t.Errorf("Expected the systemd socket to be kept, got %#v", s.listeners)
+	}
+}
+
+// reloadingConfig is replaced by the config next returns upon Reload
+type reloadingConfig struct {
+	*config
+	next func() config
+}
+
+func (c *reloadingConfig) Reload() (Config, error) {
+	next := c.next()
+	return &reloadingConfig{config: &next, next: c.next}, nil
+}
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	envfile := filepath.Join(dir, "app.env")
+	if err := ioutil.WriteFile(envfile, []byte("APP=1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %s", envfile, err)
+	}
+
+	next := config{command: "true", sigonterm: "QUIT", interval: 3, envdir: dir, envfiles: []string{envfile}}
+	c := &reloadingConfig{
+		config: &config{command: "true", sigonhup: "INT", interval: 1},
+		next:   func() config { return next },
+	}
+	s, err := NewStarter(c)
+	if err != nil {
+		t.Fatalf("Failed to create starter: %s", err)
+	}
+	defer s.Teardown()
+
+	if s.signalOnHUP != syscall.SIGINT {
+		t.Fatalf("Expected signal on HUP to be INT, got %s", s.signalOnHUP)
+	}
+	if err := s.reload(); err != nil {
+		t.Fatalf("Failed to reload: %s", err)
+	}
+	if s.signalOnHUP != syscall.SIGTERM || s.signalOnTERM != syscall.SIGQUIT {
+		t.Errorf("Expected signals TERM and QUIT, got %s and %s", s.signalOnHUP, s.signalOnTERM)
+	}
+	if s.interval != 3*time.Second {
+		t.Errorf("Expected interval of 3s, got %s", s.interval)
+	}
+	if s.baseEnv["ENVDIR"] != dir {
+		t.Errorf("Expected ENVDIR to be %s, got '%s'", dir, s.baseEnv["ENVDIR"])
+	}
+	if len(s.envFiles) != 1 || s.envFiles[0] != envfile || s.env["APP"] != "1" {
+		t.Errorf("Expected env files [%s] to be loaded, got %v", envfile, s.envFiles)
+	}
+	if c.sigonhup != "INT" || s.config.Envdir() != dir {
+		t.Errorf("Expected the starter to switch to the reloaded config, leaving the old one alone")
+	}
+
+	// Nothing is applied unless all of it can be
+	reloaded := s.config
+	next = config{command: "true", sigonhup: "USR1", interval: 5, ports: []string{freePort(t)}, envfiles: []string{filepath.Join(dir, "missing.env")}}
+	if err := s.reload(); err == nil {
+		t.Fatalf("Expected reload with a missing env file to fail")
+	}
+	if s.signalOnHUP != syscall.SIGTERM || s.interval != 3*time.Second || s.baseEnv["ENVDIR"] != dir || len(s.listeners) != 0 || s.env["APP"] != "1" {
+		t.Errorf("Expected a failed reload to leave everything alone, got signal %s, interval %s, ENVDIR '%s', %d listener(s)",
+			s.signalOnHUP, s.interval, s.baseEnv["ENVDIR"], len(s.listeners))
+	}
+	if s.config != reloaded {
+		t.Errorf("Expected a failed reload to keep the current config")
+	}
+}
@@ -0,0 +1,157 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reopener is implemented by loggers that write to a file, so that the
+// file can be reopened after it has been moved away (e.g. by logrotate)
+type Reopener interface {
+	Reopen() error
+}
+
+// FileOptions control when a File is rotated. Zero values disable the
+// corresponding rotation
+type FileOptions struct {
+	MaxSize        int64         // Rotate before the file grows beyond this many bytes
+	RotateInterval time.Duration // Rotate when the file has been written to for this long
+	MaxBackups     int           // Number of rotated files (path.1, path.2, ...) to keep
+}
+
+// File is a Logger, and an io.Writer, that appends to a file and rotates
+// it by itself. As the file is never truncated under a writer's feet,
+// it is safe to use it for output that is written to concurrently
+type File struct {
+	mu     sync.Mutex
+	path   string
+	opts   FileOptions
+	file   *os.File
+	size   int64
+	opened time.Time
+	logger *log.Logger
+}
+
+// NewFile opens path for appending
+func NewFile(path string, opts FileOptions) (*File, error) {
+	f := &File{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.logger = log.New(f, "", log.LstdFlags)
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = fi.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Printf writes a line to the file, prefixed with the current time
+func (f *File) Printf(format string, v ...interface{}) {
+	f.logger.Output(2, fmt.Sprintf(format, v...))
+}
+
+// Write appends p to the file, rotating it first if needed. Writes are
+// never split across files
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.needsRotation(len(p)) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to rotate %s: %s\n", f.path, err)
+		}
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *File) needsRotation(n int) bool {
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(n) > f.opts.MaxSize {
+		return true
+	}
+	if f.opts.RotateInterval > 0 && time.Since(f.opened) >= f.opts.RotateInterval {
+		return true
+	}
+	return false
+}
+
+// Rotate moves the current file to path.1 (shifting older backups
+// up to MaxBackups) and starts a new one
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+func (f *File) rotate() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+
+	if f.opts.MaxBackups > 0 {
+		for i := f.opts.MaxBackups - 1; i > 0; i-- {
+			os.Rename(f.backupName(i), f.backupName(i+1))
+		}
+		if err := os.Rename(f.path, f.backupName(1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
+
+func (f *File) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+// Reopen closes and reopens the file at the same path, for when it was
+// moved away by something else
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, fn string) string {
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %s", fn, err)
+	}
+	return string(buf)
+}
+
+func TestFileRotateBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "app.log")
+	f, err := NewFile(fn, FileOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("Failed to open log file: %s", err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"aaaaaaa\n", "bbbbbbb\n", "ccccccc\n", "ddddddd\n"} {
+		f.Write([]byte(line))
+	}
+
+	expect := map[string]string{
+		fn:        "ddddddd\n",
+		fn + ".1": "ccccccc\n",
+		fn + ".2": "bbbbbbb\n",
+	}
+	for name, content := range expect {
+		if got := readFile(t, name); got != content {
+			t.Errorf("Expected %s to contain %q, got %q", name, content, got)
+		}
+	}
+	if _, err := os.Stat(fn + ".3"); err == nil {
+		t.Errorf("Expected no more than 2 backups")
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "app.log")
+	f, err := NewFile(fn, FileOptions{})
+	if err != nil {
+		t.Fatalf("Failed to open log file: %s", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before\n"))
+	os.Rename(fn, fn+".old")
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("Failed to reopen: %s", err)
+	}
+	f.Write([]byte("after\n"))
+
+	if got := readFile(t, fn+".old"); got != "before\n" {
+		t.Errorf("Expected moved file to contain %q, got %q", "before\n", got)
+	}
+	if got := readFile(t, fn); got != "after\n" {
+		t.Errorf("Expected new file to contain %q, got %q", "after\n", got)
+	}
+}
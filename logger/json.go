@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// JSON is a LeveledLogger that writes one JSON object per line, with the
+// time, level, message and fields of each message as its members
+type JSON struct {
+	w io.Writer
+}
+
+// NewJSON creates a JSON logger writing to w
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{w: w}
+}
+
+func (l *JSON) Printf(format string, v ...interface{}) {
+	l.Log(Info, fmt.Sprintf(format, v...))
+}
+
+func (l *JSON) Log(level Level, msg string, fields ...Field) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeJSON(&buf, time.Now().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(&buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSON(&buf, msg)
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeJSON(&buf, f.Key)
+		buf.WriteByte(':')
+		writeJSON(&buf, f.Value)
+	}
+	buf.WriteString("}\n")
+
+	l.w.Write(buf.Bytes())
+}
+
+// Reopen reopens the underlying writer, if it is a file
+func (l *JSON) Reopen() error {
+	if r, ok := l.w.(Reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	switch x := v.(type) {
+	case error:
+		v = x.Error()
+	case fmt.Stringer:
+		v = x.String()
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%v", v))
+	}
+	buf.Write(b)
+}
@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSON(&buf)
+	l.Log(Warning, "worker 123 died", F("pid", 123), F("err", errors.New("oops")))
+	l.Printf("hello %s", "world")
+
+	dec := json.NewDecoder(&buf)
+	expect := []map[string]interface{}{
+		{"level": "warning", "msg": "worker 123 died", "pid": float64(123), "err": "oops"},
+		{"level": "info", "msg": "hello world"},
+	}
+	for _, e := range expect {
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Failed to decode: %s", err)
+		}
+		if _, ok := got["time"]; !ok {
+			t.Errorf("Expected a time member in %v", got)
+		}
+		delete(got, "time")
+		if !reflect.DeepEqual(got, e) {
+			t.Errorf("Expected %v, got %v", e, got)
+		}
+	}
+}
+
+type bufferLogger struct {
+	bytes.Buffer
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	fmt.Fprintf(l, format+"\n", v...)
+}
+
+func TestLeveled(t *testing.T) {
+	var l bufferLogger
+	Leveled(&l).Log(Error, "failed 100%", F("pid", 1))
+	if l.String() != "failed 100%\n" {
+		t.Errorf("Expected the message to be printed as is, got %q", l.String())
+	}
+
+	j := NewJSON(&l)
+	if Leveled(j) != LeveledLogger(j) {
+		t.Errorf("Expected a LeveledLogger to be returned as is")
+	}
+}
+
+func TestTagged(t *testing.T) {
+	var l bufferLogger
+	Tagged(&l, "web").Printf("worker %d died", 1)
+	if l.String() != "web: worker 1 died\n" {
+		t.Errorf("Expected the message to be prefixed, got %q", l.String())
+	}
+
+	var buf bytes.Buffer
+	Tagged(NewJSON(&buf), "web").Log(Notice, "exiting", F("pid", 1))
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to decode: %s", err)
+	}
+	delete(got, "time")
+	expect := map[string]interface{}{"level": "notice", "msg": "web: exiting", "service": "web", "pid": float64(1)}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected %v, got %v", expect, got)
+	}
+}
@@ -0,0 +1,93 @@
+package logger
+
+import "fmt"
+
+// Level is the severity of a message
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Notice
+	Warning
+	Error
+)
+
+var levelNames = map[Level]string{
+	Debug:   "debug",
+	Info:    "info",
+	Notice:  "notice",
+	Warning: "warning",
+	Error:   "error",
+}
+
+func (l Level) String() string {
+	if s, ok := levelNames[l]; ok {
+		return s
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Field is a key/value pair attached to a message, such as the pid of
+// the worker it is about
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a Field
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// LeveledLogger is a Logger that also knows about severities and fields.
+// Printf logs at Info level
+type LeveledLogger interface {
+	Logger
+	Log(level Level, msg string, fields ...Field)
+}
+
+// Leveled returns l as a LeveledLogger. If l only knows how to Printf,
+// the messages are printed as is, and the levels and fields are dropped
+func Leveled(l Logger) LeveledLogger {
+	if ll, ok := l.(LeveledLogger); ok {
+		return ll
+	}
+	return printfLogger{l}
+}
+
+type printfLogger struct {
+	Logger
+}
+
+func (l printfLogger) Log(level Level, msg string, fields ...Field) {
+	l.Printf("%s", msg)
+}
+
+// Reopen reopens the underlying logger, if it writes to a file
+func (l printfLogger) Reopen() error {
+	if r, ok := l.Logger.(Reopener); ok {
+		return r.Reopen()
+	}
+	return nil
+}
+
+// Tagged returns a logger that prefixes messages with the name of a
+// service and adds it to their fields, for services sharing l. It does
+// not reopen l, which is left to its owner
+func Tagged(l Logger, name string) LeveledLogger {
+	return taggedLogger{Leveled(l), name}
+}
+
+type taggedLogger struct {
+	l    LeveledLogger
+	name string
+}
+
+func (l taggedLogger) Printf(format string, v ...interface{}) {
+	l.l.Printf("%s: %s", l.name, fmt.Sprintf(format, v...))
+}
+
+func (l taggedLogger) Log(level Level, msg string, fields ...Field) {
+	l.l.Log(level, l.name+": "+msg, append([]Field{F("service", l.name)}, fields...)...)
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"log/syslog"
 	"os"
@@ -16,6 +17,13 @@ func NewStderr() *log.Logger {
 	return log.New(os.Stderr, "", 0)
 }
 
+// Syslog is a LeveledLogger sending messages to the local syslog daemon.
+// Printf uses the configured severity, while Log uses the severity of
+// the message's level. Fields are not sent
+type Syslog struct {
+	w *syslog.Writer
+}
+
 func NewSyslog(priority string) (*log.Logger, error) {
 	p, err := parsePriority(priority)
 	if err != nil {
@@ -24,113 +32,111 @@ func NewSyslog(priority string) (*log.Logger, error) {
 	return syslog.NewLogger(p, 0)
 }
 
+// NewLeveledSyslog is like NewSyslog, but returns a LeveledLogger that
+// sends each message with the severity of its level
+func NewLeveledSyslog(priority string) (*Syslog, error) {
+	return NewTaggedSyslog(priority, "")
+}
+
+// NewTaggedSyslog is like NewLeveledSyslog, but messages are tagged with
+// tag instead of the name of the program
+func NewTaggedSyslog(priority, tag string) (*Syslog, error) {
+	p, err := parsePriority(priority)
+	if err != nil {
+		return nil, err
+	}
+	w, err := syslog.New(p, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &Syslog{w: w}, nil
+}
+
+func (l *Syslog) Printf(format string, v ...interface{}) {
+	l.w.Write([]byte(fmt.Sprintf(format, v...)))
+}
+
+func (l *Syslog) Log(level Level, msg string, fields ...Field) {
+	switch level {
+	case Debug:
+		l.w.Debug(msg)
+	case Info:
+		l.w.Info(msg)
+	case Notice:
+		l.w.Notice(msg)
+	case Warning:
+		l.w.Warning(msg)
+	default:
+		l.w.Err(msg)
+	}
+}
+
 var ErrMultipleLevels = errors.New("cannot specify multiple levels")
+var ErrMultipleFacilities = errors.New("cannot specify multiple facilities")
+
+var severities = map[string]syslog.Priority{
+	"EMERG":   syslog.LOG_EMERG,
+	"ALERT":   syslog.LOG_ALERT,
+	"CRIT":    syslog.LOG_CRIT,
+	"ERR":     syslog.LOG_ERR,
+	"WARNING": syslog.LOG_WARNING,
+	"NOTICE":  syslog.LOG_NOTICE,
+	"INFO":    syslog.LOG_INFO,
+	"DEBUG":   syslog.LOG_DEBUG,
+}
 
+var facilities = map[string]syslog.Priority{
+	"KERN":     syslog.LOG_KERN,
+	"USER":     syslog.LOG_USER,
+	"MAIL":     syslog.LOG_MAIL,
+	"DAEMON":   syslog.LOG_DAEMON,
+	"AUTH":     syslog.LOG_AUTH,
+	"SYSLOG":   syslog.LOG_SYSLOG,
+	"LPR":      syslog.LOG_LPR,
+	"NEWS":     syslog.LOG_NEWS,
+	"UUCP":     syslog.LOG_UUCP,
+	"CRON":     syslog.LOG_CRON,
+	"AUTHPRIV": syslog.LOG_AUTHPRIV,
+	"FTP":      syslog.LOG_FTP,
+	"LOCAL0":   syslog.LOG_LOCAL0,
+	"LOCAL1":   syslog.LOG_LOCAL1,
+	"LOCAL2":   syslog.LOG_LOCAL2,
+	"LOCAL3":   syslog.LOG_LOCAL3,
+	"LOCAL4":   syslog.LOG_LOCAL4,
+	"LOCAL5":   syslog.LOG_LOCAL5,
+	"LOCAL6":   syslog.LOG_LOCAL6,
+	"LOCAL7":   syslog.LOG_LOCAL7,
+}
+
+// parsePriority parses a comma separated list of one severity and one
+// facility, such as "INFO,USER". Names are case insensitive and may have
+// a "LOG_" prefix. The severity defaults to INFO and the facility to USER.
+// A second severity or facility is reported as ErrMultipleLevels or
+// ErrMultipleFacilities, wrapped along with the offending name
 func parsePriority(priority string) (syslog.Priority, error) {
-	p := syslog.Priority(0)
-	seenLevel := false
-	for _, term := range strings.Split(strings.ToUpper(priority), ",") {
-		switch strings.TrimSpace(term) {
-		case "EMERG":
-			if seenLevel {
-				return 0, ErrMultipleLevels
-			} else {
-				p |= syslog.LOG_EMERG
-				seenLevel = true
-			}
-		case "ALERT":
-			if seenLevel {
-				return 0, ErrMultipleLevels
-			} else {
-				p |= syslog.LOG_ALERT
-				seenLevel = true
-			}
-		case "CRIT":
-			if seenLevel {
-				return 0, ErrMultipleLevels
-			} else {
-				p |= syslog.LOG_CRIT
-				seenLevel = true
-			}
-		case "ERR":
-			if seenLevel {
-				return 0, ErrMultipleLevels
-			} else {
-				p |= syslog.LOG_ERR
-				seenLevel = true
-			}
-		case "WARNING":
-			if seenLevel {
-				return 0, ErrMultipleLevels
-			} else {
-				p |= syslog.LOG_WARNING
-				seenLevel = true
-			}
-		case "NOTICE":
-			if seenLevel {
-				return 0, ErrMultipleLevels
-			} else {
-				p |= syslog.LOG_NOTICE
-				seenLevel = true
-			}
-			return syslog.LOG_NOTICE, nil
-		case "INFO":
-			if seenLevel {
-				return 0, ErrMultipleLevels
-			} else {
-				p |= syslog.LOG_INFO
-				seenLevel = true
+	severity, facility := syslog.LOG_INFO, syslog.LOG_USER
+	seenSeverity, seenFacility := false, false
+	for _, term := range strings.Split(priority, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		name := strings.TrimPrefix(strings.ToUpper(term), "LOG_")
+
+		if p, ok := severities[name]; ok {
+			if seenSeverity {
+				return 0, fmt.Errorf("%w: %q", ErrMultipleLevels, term)
 			}
-		case "DEBUG":
-			if seenLevel {
-				return 0, ErrMultipleLevels
-			} else {
-				p |= syslog.LOG_DEBUG
-				seenLevel = true
+			severity, seenSeverity = p, true
+		} else if p, ok := facilities[name]; ok {
+			if seenFacility {
+				return 0, fmt.Errorf("%w: %q", ErrMultipleFacilities, term)
 			}
-		case "KERN":
-			p |= syslog.LOG_KERN
-		case "USER":
-			p |= syslog.LOG_USER
-		case "MAIL":
-			p |= syslog.LOG_MAIL
-		case "DAEMON":
-			p |= syslog.LOG_DAEMON
-		case "AUTH":
-			p |= syslog.LOG_AUTH
-		case "SYSLOG":
-			p |= syslog.LOG_SYSLOG
-		case "LPR":
-			p |= syslog.LOG_LPR
-		case "NEWS":
-			p |= syslog.LOG_NEWS
-		case "UUCP":
-			p |= syslog.LOG_UUCP
-		case "CRON":
-			p |= syslog.LOG_CRON
-		case "AUTHPRIV":
-			p |= syslog.LOG_AUTHPRIV
-		case "FTP":
-			p |= syslog.LOG_FTP
-		case "LOCAL0":
-			p |= syslog.LOG_LOCAL0
-		case "LOCAL1":
-			p |= syslog.LOG_LOCAL1
-		case "LOCAL2":
-			p |= syslog.LOG_LOCAL2
-		case "LOCAL3":
-			p |= syslog.LOG_LOCAL3
-		case "LOCAL4":
-			p |= syslog.LOG_LOCAL4
-		case "LOCAL5":
-			p |= syslog.LOG_LOCAL5
-		case "LOCAL6":
-			p |= syslog.LOG_LOCAL6
-		case "LOCAL7":
-			p |= syslog.LOG_LOCAL7
-		default:
-			return 0, errors.New("invalid priority")
+			facility, seenFacility = p, true
+		} else {
+			return 0, fmt.Errorf("invalid priority %q", term)
 		}
 	}
-	return p, nil
+	return severity | facility, nil
 }
@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"errors"
+	"log"
+	"log/syslog"
+	"testing"
+)
+
+// NewSyslog keeps returning a *log.Logger, for existing callers
+var _ func(string) (*log.Logger, error) = NewSyslog
+
+func TestParsePriority(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		expect syslog.Priority
+	}{
+		{"INFO,USER", syslog.LOG_INFO | syslog.LOG_USER},
+		{"", syslog.LOG_INFO | syslog.LOG_USER},
+		{"NOTICE,LOCAL0", syslog.LOG_NOTICE | syslog.LOG_LOCAL0},
+		{"log_err, log_daemon", syslog.LOG_ERR | syslog.LOG_DAEMON},
+		{"debug", syslog.LOG_DEBUG | syslog.LOG_USER},
+		{"LOCAL7", syslog.LOG_INFO | syslog.LOG_LOCAL7},
+		{"EMERG,KERN", syslog.LOG_EMERG | syslog.LOG_KERN},
+	} {
+		p, err := parsePriority(c.in)
+		if err != nil {
+			t.Errorf("parsePriority(%q) failed: %s", c.in, err)
+			continue
+		}
+		if p != c.expect {
+			t.Errorf("parsePriority(%q): expected %d, got %d", c.in, c.expect, p)
+		}
+	}
+}
+
+func TestParsePriorityErrors(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		expect string
+	}{
+		{"INFO,DEBUG", `cannot specify multiple levels: "DEBUG"`},
+		{"USER,log_daemon", `cannot specify multiple facilities: "log_daemon"`},
+		{"INFO,BOGUS", `invalid priority "BOGUS"`},
+		{"LOG_", `invalid priority "LOG_"`},
+	} {
+		_, err := parsePriority(c.in)
+		if err == nil {
+			t.Errorf("parsePriority(%q): expected an error", c.in)
+			continue
+		}
+		if err.Error() != c.expect {
+			t.Errorf("parsePriority(%q): expected error %q, got %q", c.in, c.expect, err)
+		}
+	}
+
+	if _, err := parsePriority("INFO,DEBUG"); !errors.Is(err, ErrMultipleLevels) {
+		t.Errorf("Expected the error to wrap ErrMultipleLevels, got %v", err)
+	}
+	if _, err := parsePriority("USER,DAEMON"); !errors.Is(err, ErrMultipleFacilities) {
+		t.Errorf("Expected the error to wrap ErrMultipleFacilities, got %v", err)
+	}
+}
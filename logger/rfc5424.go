@@ -0,0 +1,223 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"log/syslog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sdID is the SD-ID of the structured data element carrying the fields
+// of each message
+const sdID = "starter@32473"
+
+var levelSeverities = map[Level]syslog.Priority{
+	Debug:   syslog.LOG_DEBUG,
+	Info:    syslog.LOG_INFO,
+	Notice:  syslog.LOG_NOTICE,
+	Warning: syslog.LOG_WARNING,
+	Error:   syslog.LOG_ERR,
+}
+
+// RemoteSyslog is a LeveledLogger sending RFC5424 formatted messages to
+// a syslog server. The fields of each message, such as the pid and
+// generation of a worker, are sent as structured data
+type RemoteSyslog struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	priority syslog.Priority
+	tag      string
+	hostname string
+	conn     net.Conn
+	framed   bool // Messages are sent over a stream, and need framing
+}
+
+// NewRemoteSyslog connects to the syslog server at addr, which is one of
+// "udp://host:port", "tcp://host:port" or "unix:///path/to/socket". If
+// tag is empty, the name of the program is used
+func NewRemoteSyslog(addr, priority, tag string) (*RemoteSyslog, error) {
+	p, err := parsePriority(priority)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address %s: %s", addr, err)
+	}
+	l := &RemoteSyslog{network: u.Scheme, priority: p, tag: tag}
+	switch u.Scheme {
+	case "udp", "tcp":
+		l.address = u.Host
+		if _, _, err := net.SplitHostPort(l.address); err != nil {
+			l.address = net.JoinHostPort(l.address, "514")
+		}
+	case "unix":
+		l.address = u.Path
+	default:
+		return nil, fmt.Errorf("invalid syslog address %s: scheme must be udp, tcp or unix", addr)
+	}
+
+	if l.tag == "" {
+		l.tag = filepath.Base(os.Args[0])
+	}
+	if l.hostname, err = os.Hostname(); err != nil || l.hostname == "" {
+		l.hostname = "-"
+	}
+
+	if err := l.connect(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *RemoteSyslog) connect() error {
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	network := l.network
+	if network == "unix" {
+		// Like the local syslog daemon, prefer datagrams
+		network = "unixgram"
+	}
+	c, err := net.Dial(network, l.address)
+	if err != nil && network == "unixgram" {
+		network = "unix"
+		c, err = net.Dial(network, l.address)
+	}
+	if err != nil {
+		return err
+	}
+	l.conn = c
+	l.framed = network == "tcp" || network == "unix"
+	return nil
+}
+
+func (l *RemoteSyslog) Printf(format string, v ...interface{}) {
+	l.send(l.priority&0x07, fmt.Sprintf(format, v...), nil)
+}
+
+func (l *RemoteSyslog) Log(level Level, msg string, fields ...Field) {
+	severity, ok := levelSeverities[level]
+	if !ok {
+		severity = syslog.LOG_ERR
+	}
+	l.send(severity, msg, fields)
+}
+
+func (l *RemoteSyslog) send(severity syslog.Priority, msg string, fields []Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buf := l.format(severity, msg, fields, time.Now())
+	// Reconnect once, as a stream may have been closed by the server
+	for i := 0; i < 2; i++ {
+		if l.conn == nil {
+			if err := l.connect(); err != nil {
+				break
+			}
+		}
+
+		var err error
+		if l.framed {
+			_, err = fmt.Fprintf(l.conn, "%d %s", len(buf), buf)
+		} else {
+			_, err = l.conn.Write(buf)
+		}
+		if err == nil {
+			return
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+	fmt.Fprintf(os.Stderr, "failed to send log to %s: %s\n", l.address, msg)
+}
+
+// format creates an RFC5424 message
+func (l *RemoteSyslog) format(severity syslog.Priority, msg string, fields []Field, t time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %d - ",
+		int(l.priority&^0x07|severity),
+		t.Format("2006-01-02T15:04:05.000000Z07:00"),
+		truncate(l.hostname, 255),
+		truncate(sdName(l.tag), 48),
+		os.Getpid(),
+	)
+
+	if len(fields) == 0 {
+		buf.WriteByte('-')
+	} else {
+		buf.WriteString("[" + sdID)
+		for _, f := range fields {
+			buf.WriteString(" " + truncate(sdName(f.Key), 32) + `="` + sdEscape(sdValue(f.Value)) + `"`)
+		}
+		buf.WriteByte(']')
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(strings.TrimRight(msg, "\n"))
+	return buf.Bytes()
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// sdName replaces the characters that may not appear in APP-NAME and
+// PARAM-NAME (non printable ASCII, space, '=', ']' and '"') with '_'
+func sdName(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func sdEscape(s string) string {
+	return sdEscaper.Replace(s)
+}
+
+func sdValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case error:
+		return x.Error()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Close closes the connection to the server
+func (l *RemoteSyslog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	err := l.conn.Close()
+	l.conn = nil
+	return err
+}
@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"bufio"
+	"io"
+	"log/syslog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRFC5424Format(t *testing.T) {
+	l := &RemoteSyslog{priority: syslog.LOG_INFO | syslog.LOG_DAEMON, tag: "my app", hostname: "web1"}
+	now := time.Date(2016, 1, 2, 3, 4, 5, 6000, time.UTC)
+	pid := strconv.Itoa(os.Getpid())
+
+	got := string(l.format(syslog.LOG_WARNING, "worker died\n", []Field{F("pid", 123), F("err", `bad "thing]`)}, now))
+	expect := `<28>1 2016-01-02T03:04:05.000006Z web1 my_app ` + pid + ` - [starter@32473 pid="123" err="bad \"thing\]"] worker died`
+	if got != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, got)
+	}
+
+	got = string(l.format(syslog.LOG_INFO, "hello", nil, now))
+	expect = `<30>1 2016-01-02T03:04:05.000006Z web1 my_app ` + pid + ` - - hello`
+	if got != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, got)
+	}
+}
+
+func TestRemoteSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer pc.Close()
+
+	l, err := NewRemoteSyslog("udp://"+pc.LocalAddr().String(), "INFO,LOCAL0", "starter")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %s", err)
+	}
+	defer l.Close()
+
+	l.Log(Error, "failed", F("generation", 2))
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read: %s", err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<131>1 ") || !strings.HasSuffix(msg, ` starter `+strconv.Itoa(os.Getpid())+` - [starter@32473 generation="2"] failed`) {
+		t.Errorf("Unexpected message %q", msg)
+	}
+}
+
+func TestRemoteSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer ln.Close()
+
+	l, err := NewRemoteSyslog("tcp://"+ln.Addr().String(), "INFO", "starter")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %s", err)
+	}
+	defer l.Close()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %s", err)
+	}
+	defer conn.Close()
+
+	l.Printf("one")
+	l.Printf("two")
+
+	// Messages are framed by octet counting
+	br := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expect := range []string{"one", "two"} {
+		size, err := br.ReadString(' ')
+		if err != nil {
+			t.Fatalf("Failed to read: %s", err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			t.Fatalf("Invalid frame length %q", size)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			t.Fatalf("Failed to read: %s", err)
+		}
+		if !strings.HasSuffix(string(buf), " - - "+expect) {
+			t.Errorf("Unexpected message %q", buf)
+		}
+	}
+}
+
+func TestRemoteSyslogAddr(t *testing.T) {
+	for _, addr := range []string{"localhost:514", "http://localhost", "%zz"} {
+		if _, err := NewRemoteSyslog(addr, "INFO", ""); err == nil {
+			t.Errorf("Expected %q to be rejected", addr)
+		}
+	}
+}
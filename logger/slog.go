@@ -0,0 +1,49 @@
+// +build go1.21
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Slog is a LeveledLogger that sends messages to a log/slog Logger
+type Slog struct {
+	l *slog.Logger
+}
+
+// NewSlog creates a Slog logger. If l is nil, slog.Default() is used
+func NewSlog(l *slog.Logger) *Slog {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &Slog{l: l}
+}
+
+func (l *Slog) Printf(format string, v ...interface{}) {
+	l.Log(Info, fmt.Sprintf(format, v...))
+}
+
+func (l *Slog) Log(level Level, msg string, fields ...Field) {
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	l.l.LogAttrs(context.Background(), slogLevel(level), msg, attrs...)
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case Debug:
+		return slog.LevelDebug
+	case Notice:
+		return slog.LevelInfo + 2
+	case Warning:
+		return slog.LevelWarn
+	case Error:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
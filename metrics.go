@@ -0,0 +1,131 @@
+package starter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// metrics are the counters and gauges exposed at MetricsAddr, in the
+// Prometheus text format
+type metrics struct {
+	mu              sync.Mutex
+	spawned         int
+	failedStarts    int
+	unexpectedExits map[string]int // by label pair, e.g. `status="1"`
+	restarts        map[string]int // by trigger
+	generation      int
+	oldWorkers      int
+	lastDeploy      time.Time
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		unexpectedExits: make(map[string]int),
+		restarts:        map[string]int{"hup": 0, "crash": 0, "watchdog": 0},
+	}
+}
+
+func (m *metrics) workerSpawned() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spawned++
+}
+
+// deployed records the start of a generation that was asked for, as
+// opposed to one replacing a worker that died
+func (m *metrics) deployed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastDeploy = time.Now()
+}
+
+func (m *metrics) workerFailed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failedStarts++
+}
+
+func (m *metrics) workerDied(st syscall.WaitStatus) {
+	label := `status="` + strconv.Itoa(st.ExitStatus()) + `"`
+	if st.Signaled() {
+		label = `signal="` + signame(st.Signal()) + `"`
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unexpectedExits[label]++
+}
+
+func (m *metrics) restarted(trigger string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restarts[trigger]++
+}
+
+func (m *metrics) setWorkers(generation, oldWorkers int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation = generation
+	m.oldWorkers = oldWorkers
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	family := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	labeled := func(name, label string, values map[string]int) {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := k
+			if label != "" {
+				v = label + `="` + k + `"`
+			}
+			fmt.Fprintf(w, "%s{%s} %d\n", name, v, values[k])
+		}
+	}
+
+	family("server_starter_workers_spawned_total", "counter", "Number of workers started successfully.")
+	fmt.Fprintf(w, "server_starter_workers_spawned_total %d\n", m.spawned)
+	family("server_starter_worker_start_failures_total", "counter", "Number of workers that failed to start.")
+	fmt.Fprintf(w, "server_starter_worker_start_failures_total %d\n", m.failedStarts)
+	family("server_starter_worker_unexpected_exits_total", "counter", "Number of current workers that exited on their own, by exit status or signal.")
+	labeled("server_starter_worker_unexpected_exits_total", "", m.unexpectedExits)
+	family("server_starter_restarts_total", "counter", "Number of restarts, by trigger.")
+	labeled("server_starter_restarts_total", "trigger", m.restarts)
+	family("server_starter_generation", "gauge", "Generation of the current worker.")
+	fmt.Fprintf(w, "server_starter_generation %d\n", m.generation)
+	family("server_starter_old_workers", "gauge", "Number of workers of older generations still alive.")
+	fmt.Fprintf(w, "server_starter_old_workers %d\n", m.oldWorkers)
+	if !m.lastDeploy.IsZero() {
+		family("server_starter_seconds_since_last_deploy", "gauge", "Seconds since the current generation was deployed on start, SIGHUP or by the watchdog.")
+		fmt.Fprintf(w, "server_starter_seconds_since_last_deploy %g\n", time.Since(m.lastDeploy).Seconds())
+	}
+}
+
+// serveMetrics starts serving the metrics at http://addr/metrics, until
+// the returned listener is closed
+func (s *Starter) serveMetrics(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.metrics)
+	go http.Serve(l, mux)
+	return l, nil
+}
@@ -0,0 +1,89 @@
+// +build !windows
+
+package starter
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics()
+	m.workerSpawned()
+	m.workerSpawned()
+	m.deployed()
+	m.workerFailed()
+	m.workerDied(syscall.WaitStatus(1 << 8))
+	m.restarted("hup")
+	m.setWorkers(2, 1)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	for _, line := range []string{
+		"server_starter_workers_spawned_total 2",
+		"server_starter_worker_start_failures_total 1",
+		`server_starter_worker_unexpected_exits_total{status="1"} 1`,
+		`server_starter_restarts_total{trigger="crash"} 0`,
+		`server_starter_restarts_total{trigger="hup"} 1`,
+		`server_starter_restarts_total{trigger="watchdog"} 0`,
+		"server_starter_generation 2",
+		"server_starter_old_workers 1",
+		"# TYPE server_starter_seconds_since_last_deploy gauge",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %q in\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, `trigger="auto"`) {
+		t.Errorf("Expected no series for restarts that never happen in\n%s", body)
+	}
+}
+
+func TestCrashRestartMetrics(t *testing.T) {
+	s, err := NewStarter(&config{command: "false"})
+	if err != nil {
+		t.Fatalf("Failed to create starter: %s", err)
+	}
+	s.signals = make(chan os.Signal, 1)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	defer func() {
+		s.signals <- syscall.SIGTERM
+		<-done
+	}()
+
+	crashes := func() (int, time.Time) {
+		s.metrics.mu.Lock()
+		defer s.metrics.mu.Unlock()
+		return s.metrics.restarts["crash"], s.metrics.lastDeploy
+	}
+	waitCrashes := func(n int) time.Time {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			count, lastDeploy := crashes()
+			if count >= n {
+				return lastDeploy
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the worker dying to count as a crash restart, got %d", count)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	deploy := waitCrashes(1)
+	if deploy.IsZero() {
+		t.Errorf("Expected the first generation to count as a deploy")
+	}
+	// Crash respawns are not deploys, or a crash loop would look fresh
+	if d := waitCrashes(3); !d.Equal(deploy) {
+		t.Errorf("Expected the last deploy to stay at %s, got %s", deploy, d)
+	}
+}
@@ -0,0 +1,131 @@
+package starter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lockPidFile makes sure no other start_server uses the pid file, and
+// writes our pid to it
+func (s *Starter) lockPidFile() (*os.File, error) {
+	return acquirePidFile(s.pidFile)
+}
+
+// acquirePidFile locks the pid file fn for as long as we run: our pid
+// is written to a temporary file that is locked before being renamed
+// over the pid file, so there is never a moment when it is unlocked. As
+// the file may be replaced while we wait for the lock on it, the lock
+// is only trusted if it is on the file that is at the path
+func acquirePidFile(fn string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := lockFile(f); err != nil {
+			pid := readPid(f)
+			f.Close()
+			if pid > 0 {
+				return nil, fmt.Errorf("another start_server (pid %d) is using the pid file %s", pid, fn)
+			}
+			return nil, fmt.Errorf("another start_server is using the pid file %s", fn)
+		}
+
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if cur, err := os.Stat(fn); err != nil || !os.SameFile(fi, cur) {
+			f.Close()
+			continue
+		}
+
+		// Versions of start_server that did not lock the pid file may
+		// still be running. A pid equal to ours means we re-executed
+		// ourselves to upgrade
+		if pid := readPid(f); pid > 0 && pid != os.Getpid() && isStarter(pid) {
+			f.Close()
+			return nil, fmt.Errorf("another start_server (pid %d) is running according to the pid file %s", pid, fn)
+		}
+
+		lock, err := writePidFile(fn)
+		f.Close()
+		return lock, err
+	}
+}
+
+func writePidFile(fn string) (*os.File, error) {
+	tmp := fn + ".tmp." + strconv.Itoa(os.Getpid())
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(f, "%d", os.Getpid()); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+	return f, nil
+}
+
+// isStarter reports whether pid is alive and, where that can be told,
+// runs the same program as we do
+func isStarter(pid int) bool {
+	if !processAlive(pid) {
+		return false
+	}
+	cmd, err := procCommand(pid)
+	if err != nil {
+		return true
+	}
+	return filepath.Base(cmd) == filepath.Base(os.Args[0])
+}
+
+func readPid(f *os.File) int {
+	if _, err := f.Seek(0, 0); err != nil {
+		return 0
+	}
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(buf)))
+	return pid
+}
+
+// unlockPidFile removes the pid file, unless it has been replaced by
+// someone else since
+func (s *Starter) unlockPidFile() {
+	if s.pidLock == nil {
+		return
+	}
+	releasePidFile(s.pidFile, s.pidLock)
+	s.pidLock = nil
+}
+
+// releasePidFile removes the pid file fn locked by lock, unless it has
+// been replaced by someone else since, and releases the lock
+func releasePidFile(fn string, lock *os.File) {
+	if fi, err := lock.Stat(); err == nil {
+		if cur, err := os.Stat(fn); err == nil && os.SameFile(fi, cur) {
+			os.Remove(fn)
+		}
+	}
+	lock.Close()
+}
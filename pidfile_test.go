@@ -0,0 +1,51 @@
+// +build !windows
+
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLockPidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "pid")
+	self := strconv.Itoa(os.Getpid())
+
+	// A pid file left by a dead process is taken over
+	ioutil.WriteFile(fn, []byte("999999999"), 0644)
+
+	first := &Starter{pidFile: fn}
+	if first.pidLock, err = first.lockPidFile(); err != nil {
+		t.Fatalf("lockPidFile failed: %s", err)
+	}
+	if buf, _ := ioutil.ReadFile(fn); string(buf) != self {
+		t.Errorf("Expected pid file to contain %s, got %q", self, buf)
+	}
+
+	second := &Starter{pidFile: fn}
+	if _, err := second.lockPidFile(); err == nil || !strings.Contains(err.Error(), "pid "+self) {
+		t.Errorf("Expected the locked pid file to be refused, got %v", err)
+	}
+
+	first.unlockPidFile()
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Errorf("Expected pid file to be removed")
+	}
+
+	// An unlocked pid file with our own pid, as after an upgrade
+	ioutil.WriteFile(fn, []byte(self), 0644)
+	if second.pidLock, err = second.lockPidFile(); err != nil {
+		t.Errorf("lockPidFile failed: %s", err)
+	}
+	second.unlockPidFile()
+}
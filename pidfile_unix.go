@@ -0,0 +1,18 @@
+// +build !windows
+
+package starter
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f, without waiting
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,13 @@
+package starter
+
+import "os"
+
+// lockFile is a no-op, the pid file is not locked on windows
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func processAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
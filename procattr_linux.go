@@ -0,0 +1,9 @@
+package starter
+
+import "syscall"
+
+const pdeathsigSupported = true
+
+func setPdeathsig(attr *syscall.SysProcAttr, sig syscall.Signal) {
+	attr.Pdeathsig = sig
+}
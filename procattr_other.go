@@ -0,0 +1,9 @@
+// +build !linux,!windows
+
+package starter
+
+import "syscall"
+
+const pdeathsigSupported = false
+
+func setPdeathsig(attr *syscall.SysProcAttr, sig syscall.Signal) {}
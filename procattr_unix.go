@@ -0,0 +1,48 @@
+// +build !windows
+
+package starter
+
+import (
+	"os"
+	"syscall"
+)
+
+const privilegeDropSupported = true
+
+// sysProcAttr returns the attributes of the next worker process. Each
+// worker leads its own process group, so that whatever it spawns can be
+// signalled along with it
+func (s *Starter) sysProcAttr() *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Chroot: s.chroot, Setpgid: true}
+	if s.cred.set {
+		groups := make([]uint32, len(s.cred.groups))
+		for i, gid := range s.cred.groups {
+			groups[i] = uint32(gid)
+		}
+		attr.Credential = &syscall.Credential{
+			Uid:    uint32(s.cred.uid),
+			Gid:    uint32(s.cred.gid),
+			Groups: groups,
+		}
+	}
+	if sig, ok := s.pdeathsig.(syscall.Signal); ok {
+		setPdeathsig(attr, sig)
+	}
+	return attr
+}
+
+// signalWorker sends sig to the process group of the worker pid, or to
+// the worker alone if the group is gone
+func signalWorker(pid int, sig os.Signal) error {
+	if ssig, ok := sig.(syscall.Signal); ok {
+		if err := syscall.Kill(-pid, ssig); err == nil {
+			return nil
+		}
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
@@ -0,0 +1,24 @@
+package starter
+
+import (
+	"os"
+	"syscall"
+)
+
+const privilegeDropSupported = false
+
+const pdeathsigSupported = false
+
+// sysProcAttr returns the attributes of the next worker process
+func (s *Starter) sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{}
+}
+
+// signalWorker sends sig to the worker pid
+func signalWorker(pid int, sig os.Signal) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
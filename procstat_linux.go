@@ -0,0 +1,80 @@
+package starter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const watchdogSupported = true
+
+// Clock ticks per second of the times in /proc/<pid>/stat. This is 100
+// on every platform Linux runs on today
+const clockTicks = 100
+
+// sampleProcess reads the RSS and CPU time of pid from /proc
+func sampleProcess(pid int) (procSample, error) {
+	var sample procSample
+	dir := "/proc/" + strconv.Itoa(pid)
+
+	stat, err := ioutil.ReadFile(dir + "/stat")
+	if err != nil {
+		return sample, err
+	}
+	sample.time = time.Now()
+
+	// The command name may contain anything, so skip past its last ')'.
+	// utime and stime are then the 12th and 13th fields
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return sample, fmt.Errorf("malformed %s/stat", dir)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 13 {
+		return sample, fmt.Errorf("malformed %s/stat", dir)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return sample, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return sample, err
+	}
+	sample.cpuTime = time.Duration(utime+stime) * time.Second / clockTicks
+
+	statm, err := ioutil.ReadFile(dir + "/statm")
+	if err != nil {
+		return sample, err
+	}
+	fields = strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return sample, fmt.Errorf("malformed %s/statm", dir)
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return sample, err
+	}
+	sample.rss = pages * uint64(os.Getpagesize())
+
+	return sample, nil
+}
+
+// procCommand returns the program name (argv[0]) of pid
+func procCommand(pid int) (string, error) {
+	buf, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return "", err
+	}
+	// Zombies have no command line
+	if len(buf) == 0 {
+		return "", fmt.Errorf("process %d has exited", pid)
+	}
+	if i := strings.IndexByte(string(buf), 0); i >= 0 {
+		buf = buf[:i]
+	}
+	return string(buf), nil
+}
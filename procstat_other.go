@@ -0,0 +1,15 @@
+// +build !linux
+
+package starter
+
+import "errors"
+
+const watchdogSupported = false
+
+func sampleProcess(pid int) (procSample, error) {
+	return procSample{}, errors.New("not supported on this platform")
+}
+
+func procCommand(pid int) (string, error) {
+	return "", errors.New("not supported on this platform")
+}
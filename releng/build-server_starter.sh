@@ -4,6 +4,8 @@ DIR=/work/src/github.com/lestrrat/go-server-starter
 
 pushd $DIR
 go get github.com/jessevdk/go-flags
+go get github.com/BurntSushi/toml
+go get gopkg.in/yaml.v2
 goxc \
     -n start_server \
     -tasks "xc archive" \
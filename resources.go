@@ -0,0 +1,161 @@
+package starter
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// rlimitSpec is a resource limit applied to each worker, parsed from
+// "NAME=soft[:hard]", e.g. "NOFILE=1024:65536" or "CORE=unlimited"
+type rlimitSpec struct {
+	name string
+	cur  uint64
+	max  uint64
+}
+
+const rlimInfinity = math.MaxUint64
+
+var rlimitNames = []string{"NOFILE", "AS", "CORE", "NPROC"}
+
+func parseRlimitSpec(spec string) (rlimitSpec, error) {
+	var rs rlimitSpec
+	i := strings.IndexByte(spec, '=')
+	if i < 0 {
+		return rs, fmt.Errorf("invalid rlimit '%s' (expected NAME=soft[:hard])", spec)
+	}
+	rs.name = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(spec[:i])), "RLIMIT_")
+
+	known := false
+	for _, n := range rlimitNames {
+		known = known || n == rs.name
+	}
+	if !known {
+		return rs, fmt.Errorf("unknown rlimit '%s' (expected one of %s)", rs.name, strings.Join(rlimitNames, ", "))
+	}
+
+	values := strings.SplitN(spec[i+1:], ":", 2)
+	var err error
+	if rs.cur, err = parseLimit(values[0]); err != nil {
+		return rs, fmt.Errorf("invalid rlimit '%s': %s", spec, err)
+	}
+	rs.max = rs.cur
+	if len(values) > 1 {
+		if rs.max, err = parseLimit(values[1]); err != nil {
+			return rs, fmt.Errorf("invalid rlimit '%s': %s", spec, err)
+		}
+		if rs.cur > rs.max {
+			return rs, fmt.Errorf("invalid rlimit '%s': soft limit is above hard limit", spec)
+		}
+	}
+	return rs, nil
+}
+
+// parseLimit parses "unlimited", or a number optionally followed by a
+// K, M or G multiplier
+func parseLimit(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "unlimited") {
+		return rlimInfinity, nil
+	}
+
+	mult := uint64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K', 'k':
+			mult = 1 << 10
+		case 'M', 'm':
+			mult = 1 << 20
+		case 'G', 'g':
+			mult = 1 << 30
+		}
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxUint64/mult {
+		return 0, fmt.Errorf("%s is too large", s)
+	}
+	return n * mult, nil
+}
+
+// rlimitPipe is where the rlimit helper reports an error. It is closed
+// without a word once the helper has executed the command
+type rlimitPipe struct {
+	r *os.File
+	w *os.File
+}
+
+// wait returns the error reported by the helper, if the worker was
+// started. It must be called in either case, to release the pipe
+func (p *rlimitPipe) wait(started bool) error {
+	if p == nil {
+		return nil
+	}
+	p.w.Close()
+	defer p.r.Close()
+	if !started {
+		return nil
+	}
+
+	buf, err := ioutil.ReadAll(p.r)
+	if err != nil {
+		return err
+	}
+	if len(buf) > 0 {
+		return errors.New(string(buf))
+	}
+	return nil
+}
+
+// cgroupSpec is a cgroup v2 directory under which each generation of
+// workers gets its own cgroup, parsed from "path[,memory=SIZE][,cpu=N%]"
+type cgroupSpec struct {
+	path      string
+	memoryMax uint64 // 0 for no limit
+	cpuMax    int    // percent of one CPU, 0 for no limit
+}
+
+func parseCgroupSpec(spec string) (cgroupSpec, error) {
+	parts := strings.Split(spec, ",")
+	cs := cgroupSpec{path: strings.TrimSpace(parts[0])}
+	if cs.path == "" {
+		return cs, fmt.Errorf("empty cgroup path")
+	}
+
+	for _, opt := range parts[1:] {
+		opt = strings.TrimSpace(opt)
+		i := strings.IndexByte(opt, '=')
+		if i < 0 {
+			return cs, fmt.Errorf("cgroup option %s requires a value", opt)
+		}
+		name, value := opt[:i], opt[i+1:]
+
+		switch name {
+		case "memory":
+			n, err := parseLimit(value)
+			if err != nil || n == 0 {
+				return cs, fmt.Errorf("invalid memory limit '%s'", value)
+			}
+			cs.memoryMax = n
+		case "cpu":
+			n, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+			if err != nil || n <= 0 {
+				return cs, fmt.Errorf("invalid cpu limit '%s' (expected a percentage such as 50%%)", value)
+			}
+			cs.cpuMax = n
+		default:
+			return cs, fmt.Errorf("unknown cgroup option %s", name)
+		}
+	}
+	return cs, nil
+}
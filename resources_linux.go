@@ -0,0 +1,280 @@
+package starter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Not defined by the syscall package on linux
+const _RLIMIT_NPROC = 0x6
+
+var rlimitResources = map[string]int{
+	"NOFILE": syscall.RLIMIT_NOFILE,
+	"AS":     syscall.RLIMIT_AS,
+	"CORE":   syscall.RLIMIT_CORE,
+	"NPROC":  _RLIMIT_NPROC,
+}
+
+const rlimitsSupported = true
+
+// checkRlimit fails if rs can't be applied by us: only root may raise a
+// hard limit
+func checkRlimit(rs rlimitSpec) error {
+	if os.Geteuid() == 0 {
+		return nil
+	}
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(rlimitResources[rs.name], &lim); err != nil {
+		return fmt.Errorf("failed to get rlimit %s: %s", rs.name, err)
+	}
+	if rs.max > lim.Max {
+		return fmt.Errorf("rlimit %s can't be raised above the hard limit of %d", rs.name, lim.Max)
+	}
+	return nil
+}
+
+// rlimitHelperEnvVarName is set in the environment of the rlimit helper
+const rlimitHelperEnvVarName = "SERVER_STARTER_RLIMIT_HELPER"
+
+// rlimitHelper is what start_server, re-executed as the rlimit helper,
+// needs to set the resource limits of a worker and then become the
+// command. As exec(2) keeps the limits, the command runs under them from
+// its very first instruction. The chroot and credentials of the worker
+// are set by the helper too, after the limits, so that it can still
+// raise them and find its own executable
+type rlimitHelper struct {
+	Path      string              `json:"path"`
+	Args      []string            `json:"args"`
+	Dir       string              `json:"dir,omitempty"`
+	Chroot    string              `json:"chroot,omitempty"`
+	Cred      *syscall.Credential `json:"cred,omitempty"`
+	Pdeathsig syscall.Signal      `json:"pdeathsig,omitempty"`
+	Rlimits   []rlimitValue       `json:"rlimits"`
+	Fd        int                 `json:"fd"` // where errors are reported
+}
+
+type rlimitValue struct {
+	Name string `json:"name"`
+	Cur  uint64 `json:"cur"`
+	Max  uint64 `json:"max"`
+}
+
+func init() {
+	if v := os.Getenv(rlimitHelperEnvVarName); v != "" {
+		os.Unsetenv(rlimitHelperEnvVarName)
+		runRlimitHelper(v)
+	}
+}
+
+// useRlimitHelper makes cmd start the rlimit helper, which executes the
+// command once the limits are set. The returned pipe reports whether it
+// got that far
+func (s *Starter) useRlimitHelper(cmd *exec.Cmd) (*rlimitPipe, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	attr := cmd.SysProcAttr
+	h := rlimitHelper{
+		Path:      cmd.Path,
+		Args:      cmd.Args,
+		Dir:       cmd.Dir,
+		Chroot:    attr.Chroot,
+		Cred:      attr.Credential,
+		Pdeathsig: attr.Pdeathsig,
+		Fd:        3 + len(cmd.ExtraFiles),
+	}
+	for _, rs := range s.rlimits {
+		h.Rlimits = append(h.Rlimits, rlimitValue{Name: rs.name, Cur: rs.cur, Max: rs.max})
+	}
+	buf, err := json.Marshal(h)
+	if err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+
+	// /proc/self/exe is still us after the binary is replaced on disk
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{os.Args[0]}
+	cmd.Dir = ""
+	attr.Chroot = ""
+	attr.Credential = nil
+	cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, rlimitHelperEnvVarName+"="+string(buf))
+	return &rlimitPipe{r: r, w: w}, nil
+}
+
+// runRlimitHelper sets up the worker described by v, and executes its
+// command. It never returns
+func runRlimitHelper(v string) {
+	var h rlimitHelper
+	if err := json.Unmarshal([]byte(v), &h); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse %s: %s\n", rlimitHelperEnvVarName, err)
+		os.Exit(127)
+	}
+	syscall.CloseOnExec(h.Fd)
+	ppid := os.Getppid()
+	fail := func(format string, args ...interface{}) {
+		fmt.Fprintf(os.NewFile(uintptr(h.Fd), "rlimit"), format, args...)
+		os.Exit(127)
+	}
+
+	for _, rl := range h.Rlimits {
+		lim := syscall.Rlimit{Cur: rl.Cur, Max: rl.Max}
+		if err := syscall.Setrlimit(rlimitResources[rl.Name], &lim); err != nil {
+			fail("failed to set rlimit %s: %s", rl.Name, err)
+		}
+	}
+	if h.Chroot != "" {
+		if err := syscall.Chroot(h.Chroot); err != nil {
+			fail("failed to chroot to %s: %s", h.Chroot, err)
+		}
+	}
+	if h.Dir != "" {
+		if err := syscall.Chdir(h.Dir); err != nil {
+			fail("failed to chdir to %s: %s", h.Dir, err)
+		}
+	}
+	if c := h.Cred; c != nil {
+		groups := make([]int, len(c.Groups))
+		for i, gid := range c.Groups {
+			groups[i] = int(gid)
+		}
+		if err := syscall.Setgroups(groups); err != nil {
+			fail("failed to set groups: %s", err)
+		}
+		if err := syscall.Setgid(int(c.Gid)); err != nil {
+			fail("failed to set gid %d: %s", c.Gid, err)
+		}
+		if err := syscall.Setuid(int(c.Uid)); err != nil {
+			fail("failed to set uid %d: %s", c.Uid, err)
+		}
+	}
+	// Changing credentials clears the parent death signal
+	if h.Pdeathsig != 0 {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_PDEATHSIG, uintptr(h.Pdeathsig), 0); errno != 0 {
+			fail("failed to set parent death signal: %s", errno)
+		}
+		if os.Getppid() != ppid {
+			syscall.Kill(os.Getpid(), h.Pdeathsig)
+		}
+	}
+
+	err := syscall.Exec(h.Path, h.Args, os.Environ())
+	fail("failed to exec %s: %s", h.Path, err)
+}
+
+func (s *Starter) cgroupPath(generation int) string {
+	return filepath.Join(s.cgroup.path, "gen-"+strconv.Itoa(generation))
+}
+
+// openCgroup creates the cgroup of a generation, and returns it to be
+// given to clone(2). The controllers are enabled on the parent cgroup,
+// which therefore must not contain any process (start_server included)
+func (s *Starter) openCgroup(generation int) (*os.File, error) {
+	if err := os.MkdirAll(s.cgroup.path, 0755); err != nil {
+		return nil, err
+	}
+
+	var controllers string
+	if s.cgroup.memoryMax > 0 {
+		controllers += " +memory"
+	}
+	if s.cgroup.cpuMax > 0 {
+		controllers += " +cpu"
+	}
+	if controllers != "" {
+		if err := ioutil.WriteFile(filepath.Join(s.cgroup.path, "cgroup.subtree_control"), []byte(controllers[1:]), 0644); err != nil {
+			return nil, fmt.Errorf("failed to enable controllers on %s: %s", s.cgroup.path, err)
+		}
+	}
+
+	dir := s.cgroupPath(generation)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	if s.cgroup.memoryMax > 0 {
+		if err := ioutil.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatUint(s.cgroup.memoryMax, 10)), 0644); err != nil {
+			os.Remove(dir)
+			return nil, err
+		}
+	}
+	if s.cgroup.cpuMax > 0 {
+		const period = 100000
+		max := fmt.Sprintf("%d %d", s.cgroup.cpuMax*period/100, period)
+		if err := ioutil.WriteFile(filepath.Join(dir, "cpu.max"), []byte(max), 0644); err != nil {
+			os.Remove(dir)
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		os.Remove(dir)
+		return nil, err
+	}
+	return f, nil
+}
+
+// useCgroup makes the worker start in the cgroup f
+func useCgroup(attr *syscall.SysProcAttr, f *os.File) {
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(f.Fd())
+}
+
+// removeCgroup removes the cgroup of a generation. Processes the
+// workers left behind keep it populated, in which case it is removed
+// once the last of them has exited
+func (s *Starter) removeCgroup(generation int) {
+	if s.cgroup.path == "" {
+		return
+	}
+	dir := s.cgroupPath(generation)
+	if err := os.Remove(dir); err == nil || os.IsNotExist(err) {
+		return
+	}
+	go removeCgroupWhenEmpty(dir, time.Second)
+}
+
+// removeCgroupWhenEmpty checks every interval whether the cgroup dir
+// is still populated, until it can be removed or is gone
+func removeCgroupWhenEmpty(dir string, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		populated, err := cgroupPopulated(dir)
+		if err != nil {
+			return
+		}
+		if !populated && os.Remove(dir) == nil {
+			return
+		}
+	}
+}
+
+// cgroupPopulated tells whether the cgroup dir, or any of its
+// descendants, still contains processes
+func cgroupPopulated(dir string) (bool, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.events"))
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "populated" {
+			return fields[1] != "0", nil
+		}
+	}
+	return false, fmt.Errorf("no populated key in %s/cgroup.events", dir)
+}
@@ -0,0 +1,106 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"testing"
+)
+
+func TestRlimitHelper(t *testing.T) {
+	s := &Starter{rlimits: []rlimitSpec{{name: "NOFILE", cur: 100, max: 200}}}
+
+	// The limits are those of the command itself, not set from outside
+	cmd := exec.Command("cat", "/proc/self/limits")
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	p, err := s.useRlimitHelper(cmd)
+	if err != nil {
+		t.Fatalf("useRlimitHelper failed: %s", err)
+	}
+	out, err := ioutil.TempFile("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempfile: %s", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	cmd.Stdout = out
+
+	err = cmd.Start()
+	if err := p.wait(err == nil); err != nil {
+		t.Fatalf("Expected the helper to succeed, got %s", err)
+	}
+	if err != nil {
+		t.Fatalf("Failed to start the helper: %s", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Failed to run cat: %s", err)
+	}
+
+	buf, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatalf("Failed to read limits: %s", err)
+	}
+	if !regexp.MustCompile(`Max open files\s+100\s+200\s`).Match(buf) {
+		t.Errorf("Expected open files to be limited to 100:200, got\n%s", buf)
+	}
+
+	// A failure is reported before the command runs
+	cmd = exec.Command("cat", "/proc/self/limits")
+	cmd.Dir = "/nonexistent"
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if p, err = s.useRlimitHelper(cmd); err != nil {
+		t.Fatalf("useRlimitHelper failed: %s", err)
+	}
+	err = cmd.Start()
+	if err := p.wait(err == nil); err == nil || err.Error() != "failed to chdir to /nonexistent: no such file or directory" {
+		t.Errorf("Expected the helper to fail to chdir, got %v", err)
+	}
+	if err == nil {
+		cmd.Wait()
+	}
+}
+
+func TestCgroupPopulated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := cgroupPopulated(dir); err == nil {
+		t.Errorf("Expected a directory without cgroup.events to fail")
+	}
+
+	fn := filepath.Join(dir, "cgroup.events")
+	for content, expect := range map[string]bool{
+		"populated 1\nfrozen 0\n": true,
+		"populated 0\nfrozen 0\n": false,
+	} {
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", fn, err)
+		}
+		if populated, err := cgroupPopulated(dir); err != nil || populated != expect {
+			t.Errorf("Expected populated to be %t for %q, got %t (%v)", expect, content, populated, err)
+		}
+	}
+}
+
+func TestCheckRlimit(t *testing.T) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		t.Fatalf("Failed to get rlimit: %s", err)
+	}
+	if err := checkRlimit(rlimitSpec{name: "NOFILE", cur: lim.Cur, max: lim.Max}); err != nil {
+		t.Errorf("Expected the current limits to be accepted, got %s", err)
+	}
+
+	if os.Geteuid() == 0 || lim.Max == rlimInfinity {
+		t.Skip("The hard limit can be raised")
+	}
+	if err := checkRlimit(rlimitSpec{name: "NOFILE", cur: lim.Cur, max: lim.Max + 1}); err == nil {
+		t.Errorf("Expected a limit above the hard limit to be rejected")
+	}
+}
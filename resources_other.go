@@ -0,0 +1,30 @@
+// +build !linux
+
+package starter
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var errResourcesUnsupported = errors.New("not supported on this platform")
+
+const rlimitsSupported = false
+
+func checkRlimit(rs rlimitSpec) error {
+	return errResourcesUnsupported
+}
+
+func (s *Starter) useRlimitHelper(cmd *exec.Cmd) (*rlimitPipe, error) {
+	return nil, errResourcesUnsupported
+}
+
+func (s *Starter) openCgroup(generation int) (*os.File, error) {
+	return nil, errResourcesUnsupported
+}
+
+func useCgroup(attr *syscall.SysProcAttr, f *os.File) {}
+
+func (s *Starter) removeCgroup(generation int) {}
@@ -0,0 +1,48 @@
+package starter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRlimitSpec(t *testing.T) {
+	for spec, expect := range map[string]rlimitSpec{
+		"NOFILE=1024":       {name: "NOFILE", cur: 1024, max: 1024},
+		"nofile=1024:65536": {name: "NOFILE", cur: 1024, max: 65536},
+		"RLIMIT_AS=2G":      {name: "AS", cur: 2 << 30, max: 2 << 30},
+		"CORE=0:unlimited":  {name: "CORE", cur: 0, max: rlimInfinity},
+		"NPROC=unlimited":   {name: "NPROC", cur: rlimInfinity, max: rlimInfinity},
+	} {
+		rs, err := parseRlimitSpec(spec)
+		if err != nil {
+			t.Errorf("parseRlimitSpec(%q) failed: %s", spec, err)
+			continue
+		}
+		if rs != expect {
+			t.Errorf("parseRlimitSpec(%q): expected %#v, got %#v", spec, expect, rs)
+		}
+	}
+
+	for _, spec := range []string{"NOFILE", "STACK=1024", "NOFILE=lots", "NOFILE=2048:1024", "AS=99999999999G"} {
+		if _, err := parseRlimitSpec(spec); err == nil {
+			t.Errorf("Expected parseRlimitSpec(%q) to fail", spec)
+		}
+	}
+}
+
+func TestParseCgroupSpec(t *testing.T) {
+	cs, err := parseCgroupSpec("/sys/fs/cgroup/app,memory=512M,cpu=150%")
+	if err != nil {
+		t.Fatalf("parseCgroupSpec failed: %s", err)
+	}
+	expect := cgroupSpec{path: "/sys/fs/cgroup/app", memoryMax: 512 << 20, cpuMax: 150}
+	if !reflect.DeepEqual(cs, expect) {
+		t.Errorf("Expected %#v, got %#v", expect, cs)
+	}
+
+	for _, spec := range []string{"", ",memory=1G", "/cg,memory", "/cg,memory=0", "/cg,cpu=-5%", "/cg,io=10"} {
+		if _, err := parseCgroupSpec(spec); err == nil {
+			t.Errorf("Expected parseCgroupSpec(%q) to fail", spec)
+		}
+	}
+}
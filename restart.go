@@ -0,0 +1,38 @@
+package starter
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// restartPolicy tells whether a worker that exited on its own is
+// replaced by a new one
+type restartPolicy string
+
+const (
+	restartAlways    restartPolicy = "always"
+	restartOnFailure restartPolicy = "on-failure"
+	restartNever     restartPolicy = "never"
+)
+
+func parseRestartPolicy(s string) (restartPolicy, error) {
+	switch p := restartPolicy(s); p {
+	case "":
+		return restartAlways, nil
+	case restartAlways, restartOnFailure, restartNever:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown restart policy %q", s)
+}
+
+// restarts reports whether a worker that exited with st is replaced.
+// A worker killed by a signal counts as a failure
+func (p restartPolicy) restarts(st syscall.WaitStatus) bool {
+	switch p {
+	case restartNever:
+		return false
+	case restartOnFailure:
+		return st.Signaled() || st.ExitStatus() != 0
+	}
+	return true
+}
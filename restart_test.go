@@ -0,0 +1,40 @@
+// +build !windows
+
+package starter
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestRestartPolicy(t *testing.T) {
+	exited := func(code int) syscall.WaitStatus { return syscall.WaitStatus(code << 8) }
+	killed := syscall.WaitStatus(syscall.SIGKILL)
+
+	tests := []struct {
+		policy string
+		st     syscall.WaitStatus
+		expect bool
+	}{
+		{"", exited(0), true},
+		{"always", exited(1), true},
+		{"on-failure", exited(0), false},
+		{"on-failure", exited(1), true},
+		{"on-failure", killed, true},
+		{"never", exited(1), false},
+		{"never", killed, false},
+	}
+	for _, test := range tests {
+		p, err := parseRestartPolicy(test.policy)
+		if err != nil {
+			t.Fatalf("parseRestartPolicy(%q) failed: %s", test.policy, err)
+		}
+		if p.restarts(test.st) != test.expect {
+			t.Errorf("Expected policy %q to restart=%t on status %d", test.policy, test.expect, test.st)
+		}
+	}
+
+	if _, err := parseRestartPolicy("sometimes"); err == nil {
+		t.Errorf("Expected parseRestartPolicy to fail for an unknown policy")
+	}
+}
@@ -0,0 +1,189 @@
+package starter
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// portSpec is a parsed --port argument, which looks like
+//
+//	[host:]port[,option[=value]...]
+type portSpec struct {
+	host string
+	port int
+	opts socketOptions
+}
+
+// socketOptions are the per-listener knobs that can be appended to a
+// port spec. Zero values mean "leave the OS default alone"
+type socketOptions struct {
+	backlog     int
+	reusePort   bool
+	deferAccept int // seconds
+	fastOpen    int // queue length
+	v6Only      bool
+	keepAlive   time.Duration
+	keepAliveOn bool
+}
+
+func parsePortSpec(spec string) (portSpec, error) {
+	var ps portSpec
+
+	parts := strings.Split(spec, ",")
+	addr := strings.TrimSpace(parts[0])
+	portPart := addr
+	if i := strings.LastIndexByte(addr, ':'); i >= 0 {
+		ps.host = strings.Trim(addr[:i], "[]")
+		portPart = addr[i+1:]
+	}
+
+	port, err := strconv.ParseInt(portPart, 10, 64)
+	if err != nil {
+		return ps, err
+	}
+	ps.port = int(port)
+
+	for _, opt := range parts[1:] {
+		if err := ps.opts.parse(strings.TrimSpace(opt)); err != nil {
+			return ps, err
+		}
+	}
+	return ps, nil
+}
+
+func (o *socketOptions) parse(opt string) error {
+	name, value := opt, ""
+	hasValue := false
+	if i := strings.IndexByte(opt, '='); i >= 0 {
+		name, value, hasValue = opt[:i], opt[i+1:], true
+	}
+
+	var err error
+	switch name {
+	case "backlog":
+		o.backlog, err = parsePositiveInt(name, value)
+	case "reuseport":
+		o.reusePort = true
+	case "defer_accept":
+		o.deferAccept = 1
+		if hasValue {
+			o.deferAccept, err = parsePositiveInt(name, value)
+		}
+	case "fastopen":
+		o.fastOpen, err = parsePositiveInt(name, value)
+	case "v6only":
+		o.v6Only = true
+	case "keepalive":
+		o.keepAliveOn = true
+		if hasValue {
+			o.keepAlive, err = parseSeconds(value)
+			if err != nil {
+				err = fmt.Errorf("invalid value for socket option keepalive: %s", err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown socket option '%s'", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "reuseport", "v6only":
+		if hasValue {
+			return fmt.Errorf("socket option %s does not take a value", name)
+		}
+	}
+	return nil
+}
+
+func parsePositiveInt(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("socket option %s requires a positive integer (got '%s')", name, value)
+	}
+	return n, nil
+}
+
+// parseSeconds accepts either a plain number of seconds, or anything
+// time.ParseDuration understands
+func parseSeconds(v string) (time.Duration, error) {
+	if n, err := strconv.Atoi(v); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// network returns the network to pass to net.Listen. Plain hosts keep
+// the historical tcp4 behavior, IPv6 literals and v6only use tcp6
+func (ps portSpec) network() string {
+	if ps.opts.v6Only || strings.IndexByte(ps.host, ':') >= 0 {
+		return "tcp6"
+	}
+	return "tcp4"
+}
+
+func (ps portSpec) hostport() string {
+	return net.JoinHostPort(ps.host, strconv.Itoa(ps.port))
+}
+
+// String returns the spec as it is advertised in SERVER_STARTER_PORT
+func (ps portSpec) String() string {
+	if ps.host == "" {
+		return strconv.Itoa(ps.port)
+	}
+	return ps.hostport()
+}
+
+// control is used as net.ListenConfig.Control, so that options are set
+// after the socket is created but before it is bound
+func (o socketOptions) control(network, address string, c syscall.RawConn) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) { serr = o.apply(fd) }); err != nil {
+		return err
+	}
+	if serr != nil {
+		return fmt.Errorf("failed to set socket options on %s: %s", address, serr)
+	}
+	return nil
+}
+
+// setBacklog re-issues listen(2) on an already listening socket, which
+// is how the backlog gets changed after net.Listen picked its default
+func (o socketOptions) setBacklog(l net.Listener) error {
+	if o.backlog == 0 {
+		return nil
+	}
+
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	rc, err := tl.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var serr error
+	if err := rc.Control(func(fd uintptr) { serr = listenBacklog(fd, o.backlog) }); err != nil {
+		return err
+	}
+	if serr != nil {
+		return fmt.Errorf("failed to set backlog to %d on %s: %s", o.backlog, l.Addr(), serr)
+	}
+	return nil
+}
+
+// sockoptError records which option could not be applied
+type sockoptError struct {
+	name string
+	err  error
+}
+
+func (e *sockoptError) Error() string {
+	return fmt.Sprintf("%s: %s", e.name, e.err)
+}
@@ -0,0 +1,55 @@
+package starter
+
+import (
+	"syscall"
+	"time"
+)
+
+// These are missing from package syscall
+const (
+	soReusePort = 0xf
+	tcpFastOpen = 0x17
+)
+
+func (o socketOptions) apply(fd uintptr) error {
+	s := int(fd)
+	if o.reusePort {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+			return &sockoptError{"reuseport", err}
+		}
+	}
+	if o.v6Only {
+		if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 1); err != nil {
+			return &sockoptError{"v6only", err}
+		}
+	}
+	if o.deferAccept > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, o.deferAccept); err != nil {
+			return &sockoptError{"defer_accept", err}
+		}
+	}
+	if o.fastOpen > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, tcpFastOpen, o.fastOpen); err != nil {
+			return &sockoptError{"fastopen", err}
+		}
+	}
+	if o.keepAliveOn {
+		// Accepted sockets inherit these from the listening socket
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1); err != nil {
+			return &sockoptError{"keepalive", err}
+		}
+		if secs := int(o.keepAlive / time.Second); secs > 0 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, secs); err != nil {
+				return &sockoptError{"keepalive", err}
+			}
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, secs); err != nil {
+				return &sockoptError{"keepalive", err}
+			}
+		}
+	}
+	return nil
+}
+
+func listenBacklog(fd uintptr, n int) error {
+	return syscall.Listen(int(fd), n)
+}
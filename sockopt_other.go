@@ -0,0 +1,43 @@
+// +build !linux,!windows
+
+package starter
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errSockoptUnsupported = errors.New("not supported on this platform")
+
+func (o socketOptions) apply(fd uintptr) error {
+	s := int(fd)
+	if o.reusePort {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1); err != nil {
+			return &sockoptError{"reuseport", err}
+		}
+	}
+	if o.v6Only {
+		if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 1); err != nil {
+			return &sockoptError{"v6only", err}
+		}
+	}
+	if o.deferAccept > 0 {
+		return &sockoptError{"defer_accept", errSockoptUnsupported}
+	}
+	if o.fastOpen > 0 {
+		return &sockoptError{"fastopen", errSockoptUnsupported}
+	}
+	if o.keepAliveOn {
+		if o.keepAlive > 0 {
+			return &sockoptError{"keepalive", errors.New("idle time is not supported on this platform")}
+		}
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, 1); err != nil {
+			return &sockoptError{"keepalive", err}
+		}
+	}
+	return nil
+}
+
+func listenBacklog(fd uintptr, n int) error {
+	return syscall.Listen(int(fd), n)
+}
@@ -0,0 +1,14 @@
+package starter
+
+import "errors"
+
+func (o socketOptions) apply(fd uintptr) error {
+	if o != (socketOptions{}) {
+		return errors.New("socket options are not supported on windows")
+	}
+	return nil
+}
+
+func listenBacklog(fd uintptr, n int) error {
+	return errors.New("setting the backlog is not supported on windows")
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -46,28 +47,40 @@ func makeNiceSigNames() map[syscall.Signal]string {
 
 func init() {
 	niceSigNames = makeNiceSigNames()
-	niceNameToSigs := make(map[string]syscall.Signal)
+	niceNameToSigs = make(map[string]syscall.Signal)
 	for sig, name := range niceSigNames {
 		niceNameToSigs[name] = sig
 	}
 }
 
-type listener struct {
-	listener net.Listener
-	spec     string // path or port spec
-}
-
 type Config interface {
 	Args() []string
 	Command() string
 	Dir() string             // Dirctory to chdir to before executing the command
+	Envdir() string          // Directory of environment variables, overriding ENVDIR
+	EnvFiles() []string      // dotenv style files to read environment variables from
+	RedactEnv() []string     // Variables whose values are not logged (globs, e.g. "*SECRET*")
 	Interval() time.Duration // Time between checks for liveness
+	RestartPolicy() string   // When to respawn workers that exit: "always" (default), "on-failure" or "never"
 	PidFile() string
-	Ports() []string         // Ports to bind to (addr:port or port, so it's a string)
-	Paths() []string         // Paths (UNIX domain socket) to bind to
+	Ports() []string         // Ports to bind to (addr:port or port, optionally followed by ",option=value")
+	Paths() []string         // Paths (UNIX domain socket) to bind to, optionally followed by ",mode=0660,owner=user,group=group"
 	SignalOnHUP() os.Signal  // Signal to send when HUP is received
 	SignalOnTERM() os.Signal // Signal to send when TERM is received
 	StatusFile() string
+	SystemdSockets() []string        // LISTEN_FDNAMES names of the systemd sockets to pass on, after the ports and paths
+	User() string                    // User to run workers as
+	Group() string                   // Group to run workers as (default: the user's group)
+	Groups() []string                // Supplementary groups of workers (default: the user's groups)
+	Chroot() string                  // Directory to chroot workers into
+	SignalOnParentDeath() os.Signal  // Signal workers get when start_server dies, if any (Linux only)
+	ChildSubreaper() bool            // Adopt and reap the processes orphaned by workers (Linux only)
+	Watchdog() string                // Thresholds above which workers are replaced ("rss=512M,cpu=90%,for=1m")
+	Rlimits() []string               // Resource limits of workers ("NOFILE=1024[:4096]")
+	Cgroup() string                  // cgroup v2 directory to put each generation in, optionally followed by ",memory=512M,cpu=50%"
+	MetricsAddr() string             // Address to serve Prometheus metrics at, if any
+	WorkerLog() string               // "" to share our stdout/stderr, "logger" or a file name
+	LogRotation() logger.FileOptions // How the worker log file is rotated
 	Logger() logger.Logger
 }
 
@@ -75,17 +88,40 @@ type Starter struct {
 	interval     time.Duration
 	signalOnHUP  os.Signal
 	signalOnTERM os.Signal
-	// you can't set this in go:	backlog
-	statusFile string
-	pidFile    string
-	dir        string
-	ports      []string
-	paths      []string
-	listeners  []listener
-	generation int
-	command    string
-	args       []string
-	logger     logger.Logger
+	statusFile   string
+	pidFile      string
+	pidLock      *os.File
+	dir          string
+	ports        []portSpec
+	paths        []pathSpec
+	listeners    []listener
+	generation   int
+	command      string
+	args         []string
+	logger       logger.LeveledLogger
+	config       Config
+	env          map[string]string // environment of the latest generation
+	baseEnv      map[string]string // environment start_server was started with
+	envFiles     []string
+	redactEnv    []string
+	runningEnv   map[string]string // environment of the most recently spawned generation
+	workerLog    string
+	workerFile   *logger.File
+	logRotation  logger.FileOptions
+	metricsAddr  string
+	metrics      *metrics
+	metricsLn    net.Listener
+	rlimits      []rlimitSpec
+	cgroup       cgroupSpec
+	cred         credentials
+	chroot       string
+	watchdog     *watchdog
+	pdeathsig    os.Signal
+	subreaper    bool
+	pgroups      map[int]int // generation of each worker process group, when subreaper
+	restart      restartPolicy
+	signals      chan os.Signal // signals forwarded by a Supervisor, instead of ours
+	status       *workerStatus
 }
 
 // NewStarter creates a new Starter object. Config parameter may NOT be
@@ -107,23 +143,119 @@ func NewStarter(c Config) (*Starter, error) {
 	if c.Command() == "" {
 		return nil, fmt.Errorf("argument Command must be specified")
 	}
-	if _, err := exec.LookPath(c.Command()); err != nil {
+	if chroot := c.Chroot(); chroot != "" {
+		// The command is looked up after chroot(2)
+		if !filepath.IsAbs(c.Command()) {
+			return nil, fmt.Errorf("argument Command must be an absolute path within %s", chroot)
+		}
+		if _, err := os.Stat(filepath.Join(chroot, c.Command())); err != nil {
+			return nil, err
+		}
+	} else if _, err := exec.LookPath(c.Command()); err != nil {
+		return nil, err
+	}
+
+	cred, err := lookupCredentials(c.User(), c.Group(), c.Groups())
+	if err != nil {
+		return nil, err
+	}
+	if (cred.set || c.Chroot() != "") && !privilegeDropSupported {
+		return nil, fmt.Errorf("running workers as another user or in a chroot is not supported on this platform")
+	}
+
+	ports, paths, err := parseListenSpecs(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var rlimits []rlimitSpec
+	for _, spec := range c.Rlimits() {
+		rs, err := parseRlimitSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		rlimits = append(rlimits, rs)
+	}
+	if len(rlimits) > 0 && !rlimitsSupported {
+		return nil, fmt.Errorf("resource limits are not supported on this platform")
+	}
+	for _, rs := range rlimits {
+		if err := checkRlimit(rs); err != nil {
+			return nil, err
+		}
+	}
+
+	var cgroup cgroupSpec
+	if spec := c.Cgroup(); spec != "" {
+		if cgroup, err = parseCgroupSpec(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	var wd *watchdog
+	if spec := c.Watchdog(); spec != "" {
+		if !watchdogSupported {
+			return nil, fmt.Errorf("watchdog is not supported on this platform")
+		}
+		ws, err := parseWatchdogSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		wd = &watchdog{spec: ws}
+	}
+
+	if c.SignalOnParentDeath() != nil && !pdeathsigSupported {
+		return nil, fmt.Errorf("parent death signal is not supported on this platform")
+	}
+	if c.ChildSubreaper() && !childSubreaperSupported {
+		return nil, fmt.Errorf("child subreaper is not supported on this platform")
+	}
+
+	redactPatterns := c.RedactEnv()
+	if redactPatterns == nil {
+		redactPatterns = defaultEnvRedactPatterns
+	}
+
+	restart, err := parseRestartPolicy(c.RestartPolicy())
+	if err != nil {
 		return nil, err
 	}
 
+	base := baseEnv()
+	setEnvdir(base, c.Envdir())
+
 	s := &Starter{
 		args:         c.Args(),
 		command:      c.Command(),
+		config:       c,
 		dir:          c.Dir(),
 		interval:     c.Interval(),
+		env:          baseEnv(),
+		envFiles:     c.EnvFiles(),
+		redactEnv:    redactPatterns,
+		baseEnv:      base,
 		listeners:    make([]listener, 0, len(c.Ports())+len(c.Paths())),
 		pidFile:      c.PidFile(),
-		ports:        c.Ports(),
-		paths:        c.Paths(),
+		ports:        ports,
+		paths:        paths,
 		signalOnHUP:  signalOnHUP,
 		signalOnTERM: signalOnTERM,
 		statusFile:   c.StatusFile(),
-		logger:       c.Logger(),
+		workerLog:    c.WorkerLog(),
+		logRotation:  c.LogRotation(),
+		metricsAddr:  c.MetricsAddr(),
+		metrics:      newMetrics(),
+		rlimits:      rlimits,
+		cgroup:       cgroup,
+		cred:         cred,
+		chroot:       c.Chroot(),
+		watchdog:     wd,
+		pdeathsig:    c.SignalOnParentDeath(),
+		subreaper:    c.ChildSubreaper(),
+		pgroups:      make(map[int]int),
+		restart:      restart,
+		status:       &workerStatus{},
+		logger:       logger.Leveled(c.Logger()),
 	}
 
 	return s, nil
@@ -131,6 +263,10 @@ func NewStarter(c Config) (*Starter, error) {
 }
 
 func (s Starter) Stop() {
+	if s.signals != nil {
+		go func() { s.signals <- syscall.SIGTERM }()
+		return
+	}
 	p, _ := os.FindProcess(os.Getpid())
 	p.Signal(syscall.SIGTERM)
 }
@@ -171,147 +307,90 @@ func signame(s os.Signal) string {
 }
 
 func SigFromName(n string) os.Signal {
-	if sig, ok := niceNameToSigs[n]; ok {
+	if sig, ok := niceNameToSigs[strings.TrimPrefix(strings.ToUpper(n), "SIG")]; ok {
 		return sig
 	}
 	return nil
 }
 
-func setEnv() error {
-	if os.Getenv("ENVDIR") == "" {
-		return nil
-	}
-
-	m, err := reloadEnv()
-	if err != nil && err != errNoEnv {
-		// do something
-		return fmt.Errorf("failed to load from envdir: %s", err)
-	}
-
-	for k, v := range m {
-		os.Setenv(k, v)
-	}
-	return nil
-}
-
-func parsePortSpec(addr string) (string, int, error) {
-	i := strings.IndexByte(addr, ':')
-	portPart := ""
-	if i < 0 {
-		portPart = addr
-		addr = ""
-	} else {
-		portPart = addr[i+1:]
-		addr = addr[:i]
-	}
-
-	port, err := strconv.ParseInt(portPart, 10, 64)
-	if err != nil {
-		return "", -1, err
-	}
-
-	return addr, int(port), nil
-}
-
 func (s *Starter) Run() error {
-	defer s.Teardown()
-
+	// Before anything that Teardown would undo, as the files may belong
+	// to another start_server
 	if s.pidFile != "" {
-		f, err := os.OpenFile(s.pidFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		f, err := s.lockPidFile()
 		if err != nil {
+			s.logger.Log(logger.Error, err.Error())
 			return err
 		}
-
-		fmt.Fprintf(f, "%d", os.Getpid())
-		f.Close()
+		s.pidLock = f
 	}
+	defer s.Teardown()
 
-	for _, addr := range s.ports {
-		var l net.Listener
+	upgraded, err := loadUpgradeState()
+	if err != nil {
+		s.logger.Log(logger.Error, err.Error())
+		return err
+	}
 
-		host, port, err := parsePortSpec(addr)
-		if err != nil {
-			s.logger.Printf("failed to parse addr spec '%s': %s", addr, err)
-			return err
-		}
+	if upgraded != nil {
+		err = s.resumeListeners(upgraded)
+	} else {
+		s.killStaleWorkers()
+		err = s.bindListeners()
+	}
+	if err != nil {
+		return err
+	}
 
-		hostport := fmt.Sprintf("%s:%d", host, port)
-		l, err = net.Listen("tcp4", hostport)
-		if err != nil {
-			s.logger.Printf("failed to listen to %s:%s", hostport, err)
-			return err
-		}
+	s.generation = 0
 
-		spec := ""
-		if host == "" {
-			spec = fmt.Sprintf("%d", port)
-		} else {
-			spec = fmt.Sprintf("%s:%d", host, port)
+	if s.subreaper {
+		if err := setChildSubreaper(); err != nil {
+			s.logger.Log(logger.Warning, fmt.Sprintf("failed to become a child subreaper, orphans will not be reaped: %s", err))
+			s.subreaper = false
 		}
-		s.listeners = append(s.listeners, listener{listener: l, spec: spec})
 	}
 
-	for _, path := range s.paths {
-		var l net.Listener
-		if fl, err := os.Lstat(path); err == nil && fl.Mode()&os.ModeSocket == os.ModeSocket {
-			s.logger.Printf("removing existing socket file:%s", path)
-			err = os.Remove(path)
-			if err != nil {
-				s.logger.Printf("failed to remove existing socket file:%s:%s", path, err)
-				return err
-			}
-		}
-		_ = os.Remove(path)
-		l, err := net.Listen("unix", path)
-		if err != nil {
-			s.logger.Printf("failed to listen file:%s:%s", path, err)
+	if s.metricsAddr != "" {
+		if s.metricsLn, err = s.serveMetrics(s.metricsAddr); err != nil {
+			s.logger.Log(logger.Error, fmt.Sprintf("failed to serve metrics at %s: %s", s.metricsAddr, err))
 			return err
 		}
-		s.listeners = append(s.listeners, listener{listener: l, spec: path})
 	}
 
-	s.generation = 0
-	os.Setenv("SERVER_STARTER_GENERATION", fmt.Sprintf("%d", s.generation))
-
 	// XXX Not portable
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh,
-		syscall.SIGHUP,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGQUIT,
-	)
+	sigCh := s.signals
+	if sigCh == nil {
+		sigCh = make(chan os.Signal, 1)
+		signal.Notify(sigCh,
+			syscall.SIGHUP,
+			syscall.SIGINT,
+			syscall.SIGTERM,
+			syscall.SIGQUIT,
+			upgradeSignal,
+			reopenSignal,
+		)
+	}
 
 	// Okay, ready to launch the program now...
-	err := setEnv()
-	if err != nil {
-		s.logger.Printf("%s", err)
+	if err := s.loadEnv(); err != nil {
+		s.logger.Log(logger.Error, err.Error())
 	}
+	s.runningEnv = s.env
 	workerCh := make(chan processState)
-	p := s.StartWorker(sigCh, workerCh)
 	oldWorkers := make(map[int]int)
+	var p *os.Process
+	if upgraded != nil {
+		p = s.resumeWorkers(upgraded, oldWorkers, workerCh)
+	} else {
+		p = s.StartWorker(sigCh, workerCh)
+		s.metrics.deployed()
+	}
 	var sigReceived os.Signal
 	var sigToSend os.Signal
 
-	statusCh := make(chan map[int]int)
-	go func(fn string, ch chan map[int]int) {
-		for wmap := range ch {
-			if fn == "" {
-				continue
-			}
-
-			f, err := os.OpenFile(fn, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-			if err != nil {
-				continue
-			}
-
-			for gen, pid := range wmap {
-				fmt.Fprintf(f, "%d:%d\n", gen, pid)
-			}
-
-			f.Close()
-		}
-	}(s.statusFile, statusCh)
+	s.status.set(p, s.generation, oldWorkers)
+	s.writeStatusFile(p, oldWorkers)
 
 	defer func() {
 		if p != nil {
@@ -328,118 +407,190 @@ func (s *Starter) Run() error {
 				b = append(b, ',')
 			}
 		}
-		s.logger.Printf("received %s, sending %s to all workers:%s",
-			signame(sigReceived),
-			signame(sigToSend),
-			string(b),
-		)
+		if sigReceived != nil {
+			s.logger.Log(logger.Notice,
+				fmt.Sprintf("received %s, sending %s to all workers:%s",
+					signame(sigReceived),
+					signame(sigToSend),
+					string(b),
+				),
+				logger.F("signal", signame(sigReceived)),
+			)
+		} else if size > 0 {
+			s.logger.Log(logger.Info, fmt.Sprintf("sending %s to old workers:%s", signame(sigToSend), string(b)))
+		}
 
 		for pid := range oldWorkers {
-			worker, err := os.FindProcess(pid)
-			if err != nil {
-				continue
-			}
-			worker.Signal(sigToSend)
+			signalWorker(pid, sigToSend)
 		}
 
 		for len(oldWorkers) > 0 {
 			st := <-workerCh
-			s.logger.Printf("worker %d died, status:%d", st.Pid(), grabExitStatus(st))
+			exitSt := grabExitStatus(st)
+			s.logger.Log(logger.Info, fmt.Sprintf("worker %d died, status:%d", st.Pid(), exitSt),
+				logger.F("pid", st.Pid()), logger.F("status", int(exitSt)))
+			s.removeCgroup(oldWorkers[st.Pid()])
 			delete(oldWorkers, st.Pid())
 		}
-		s.logger.Printf("exiting")
+		if s.subreaper {
+			s.reapOrphans(map[int]bool{})
+		}
+		s.logger.Log(logger.Notice, "exiting")
 	}()
 
-	//	var lastRestartTime time.Time
-	for { // outer loop
-		err = setEnv()
-		if err != nil {
-			s.logger.Printf("%s", err)
-		}
+	var watchdogCh <-chan time.Time
+	if s.watchdog != nil {
+		t := time.NewTicker(s.watchdog.spec.interval)
+		defer t.Stop()
+		watchdogCh = t.C
+	}
 
-		// Just wait for the worker to exit, or for us to receive a signal
-		for {
-			// restart = 2: force restart
-			// restart = 1 and no workers: force restart
-			// restart = 0: no restart
-			restart := 0
-
-			select {
-			case st := <-workerCh:
-				// oops, the worker exited? check for its pid
-				if p.Pid == st.Pid() { // current worker
-					exitSt := grabExitStatus(st)
-					s.logger.Printf("worker %d died unexpectedly with status %d, restarting", p.Pid, exitSt)
-					p = s.StartWorker(sigCh, workerCh)
-					// lastRestartTime = time.Now()
-				} else {
-					exitSt := grabExitStatus(st)
-					s.logger.Printf("old worker %d died, status:%d", st.Pid(), exitSt)
-					delete(oldWorkers, st.Pid())
-				}
-			case sigReceived = <-sigCh:
-				// Temporary fix
-				switch sigReceived {
-				case syscall.SIGHUP:
-					// When we receive a HUP signal, we need to spawn a new worker
-					s.logger.Printf("received HUP (num_old_workers=TODO)")
-					restart = 1
-					sigToSend = s.signalOnHUP
-				case syscall.SIGTERM:
-					sigToSend = s.signalOnTERM
-					return nil
-				default:
+	var reapCh <-chan time.Time
+	if s.subreaper {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		reapCh = t.C
+	}
+
+	//	var lastRestartTime time.Time
+	// Just wait for the worker to exit, or for us to receive a signal
+	for {
+		// restart = 2: force restart
+		// restart = 1 and no workers: force restart
+		// restart = 0: no restart
+		restart := 0
+		trigger := ""
+
+		select {
+		case st := <-workerCh:
+			// oops, the worker exited? check for its pid
+			if p.Pid == st.Pid() { // current worker
+				exitSt := grabExitStatus(st)
+				if !s.restart.restarts(exitSt) {
+					s.logger.Log(logger.Notice, fmt.Sprintf("worker %d exited with status %d, not restarting (restart policy: %s)", p.Pid, exitSt, s.restart),
+						logger.F("pid", p.Pid), logger.F("generation", s.generation), logger.F("status", int(exitSt)))
+					s.metrics.workerDied(exitSt)
+					s.removeCgroup(s.generation)
+					p = nil
 					sigToSend = syscall.SIGTERM
 					return nil
 				}
+				s.logger.Log(logger.Error, fmt.Sprintf("worker %d died unexpectedly with status %d, restarting", p.Pid, exitSt),
+					logger.F("pid", p.Pid), logger.F("generation", s.generation), logger.F("status", int(exitSt)))
+				s.metrics.workerDied(exitSt)
+				s.metrics.restarted("crash")
+				s.removeCgroup(s.generation)
+				p = s.StartWorker(sigCh, workerCh)
+				// lastRestartTime = time.Now()
+			} else {
+				exitSt := grabExitStatus(st)
+				s.logger.Log(logger.Info, fmt.Sprintf("old worker %d died, status:%d", st.Pid(), exitSt),
+					logger.F("pid", st.Pid()), logger.F("generation", oldWorkers[st.Pid()]), logger.F("status", int(exitSt)))
+				s.removeCgroup(oldWorkers[st.Pid()])
+				delete(oldWorkers, st.Pid())
+			}
+		case <-reapCh:
+			workers := map[int]bool{p.Pid: true}
+			for pid := range oldWorkers {
+				workers[pid] = true
+			}
+			s.reapOrphans(workers)
+		case <-watchdogCh:
+			sample, err := sampleProcess(p.Pid)
+			if err != nil {
+				break
+			}
+			if reason, tripped := s.watchdog.observe(p.Pid, sample); tripped {
+				s.logger.Log(logger.Warning, fmt.Sprintf("worker %d exceeded watchdog thresholds: %s, restarting", p.Pid, reason),
+					logger.F("pid", p.Pid), logger.F("generation", s.generation), logger.F("rss", sample.rss))
+				// Unlike a HUP, don't wait for older generations to
+				// go away: the current worker is the one misbehaving
+				restart = 2
+				trigger = "watchdog"
+				sigToSend = s.signalOnHUP
 			}
+		case sigReceived = <-sigCh:
+			// Temporary fix
+			switch sigReceived {
+			case syscall.SIGHUP:
+				// When we receive a HUP signal, we need to spawn a new worker
+				s.logger.Log(logger.Notice, "received HUP (num_old_workers=TODO)", logger.F("signal", "HUP"))
+				if err := s.reload(); err != nil {
+					s.logger.Log(logger.Error, fmt.Sprintf("failed to reload configuration, keeping the current worker: %s", err))
+					break
+				}
+				restart = 1
+				trigger = "hup"
+				sigToSend = s.signalOnHUP
+			case upgradeSignal:
+				s.logger.Log(logger.Notice, fmt.Sprintf("received %s, upgrading start_server", signame(sigReceived)),
+					logger.F("signal", signame(sigReceived)))
+				if err := s.upgrade(p, oldWorkers); err != nil {
+					s.logger.Log(logger.Error, fmt.Sprintf("failed to upgrade: %s", err))
+				}
+			case reopenSignal:
+				s.logger.Log(logger.Info, fmt.Sprintf("received %s, reopening log files", signame(sigReceived)),
+					logger.F("signal", signame(sigReceived)))
+				s.reopenLogs()
+			case syscall.SIGTERM:
+				sigToSend = s.signalOnTERM
+				return nil
+			default:
+				sigToSend = syscall.SIGTERM
+				return nil
+			}
+		}
 
-			if restart > 1 || restart > 0 && len(oldWorkers) == 0 {
-				s.logger.Printf("spawning a new worker (num_old_workers=TODO)")
-				oldWorkers[p.Pid] = s.generation
-				p = s.StartWorker(sigCh, workerCh)
-				size := len(oldWorkers)
-				if size == 0 {
-					s.logger.Printf("new worker is now running, sending %s to old workers:none", signame(sigToSend))
-				} else {
-					i := 0
-					var b []byte
-					for pid := range oldWorkers {
-						i++
-						b = strconv.AppendInt(b, int64(pid), 10)
-						if i < size {
-							b = append(b, ',')
-						}
+		if restart > 1 || restart > 0 && len(oldWorkers) == 0 {
+			s.logger.Log(logger.Info, "spawning a new worker (num_old_workers=TODO)")
+			s.logEnvDiff(s.runningEnv, s.env, s.generation+1)
+			s.runningEnv = s.env
+			oldWorkers[p.Pid] = s.generation
+			p = s.StartWorker(sigCh, workerCh)
+			s.metrics.restarted(trigger)
+			s.metrics.deployed()
+			size := len(oldWorkers)
+			if size == 0 {
+				s.logger.Log(logger.Info, fmt.Sprintf("new worker is now running, sending %s to old workers:none", signame(sigToSend)),
+					logger.F("pid", p.Pid), logger.F("generation", s.generation))
+			} else {
+				i := 0
+				var b []byte
+				for pid := range oldWorkers {
+					i++
+					b = strconv.AppendInt(b, int64(pid), 10)
+					if i < size {
+						b = append(b, ',')
 					}
-					s.logger.Printf("new worker is now running, sending %s to old workers:%s", signame(sigToSend), string(b))
+				}
+				s.logger.Log(logger.Info, fmt.Sprintf("new worker is now running, sending %s to old workers:%s", signame(sigToSend), string(b)),
+					logger.F("pid", p.Pid), logger.F("generation", s.generation), logger.F("signal", signame(sigToSend)))
 
-					killOldDelay := getKillOldDelay()
-					s.logger.Printf("sleep %d secs", int(killOldDelay/time.Second))
-					if killOldDelay > 0 {
-						time.Sleep(killOldDelay)
-					}
+				killOldDelay := getKillOldDelay(s.env)
+				s.logger.Log(logger.Debug, fmt.Sprintf("sleep %d secs", int(killOldDelay/time.Second)))
+				if killOldDelay > 0 {
+					time.Sleep(killOldDelay)
+				}
 
-					s.logger.Printf("killing old workers")
+				s.logger.Log(logger.Info, "killing old workers")
 
-					for pid := range oldWorkers {
-						worker, err := os.FindProcess(pid)
-						if err != nil {
-							continue
-						}
-						worker.Signal(s.signalOnHUP)
-					}
+				for pid := range oldWorkers {
+					signalWorker(pid, s.signalOnHUP)
 				}
 			}
 		}
+		s.metrics.setWorkers(s.generation, len(oldWorkers))
+		s.status.set(p, s.generation, oldWorkers)
+		s.writeStatusFile(p, oldWorkers)
 	}
 
 	return nil
 }
 
-func getKillOldDelay() time.Duration {
+func getKillOldDelay(env map[string]string) time.Duration {
 	// Ignore errors.
-	delay, _ := strconv.ParseInt(os.Getenv("KILL_OLD_DELAY"), 10, 0)
-	autoRestart, _ := strconv.ParseBool(os.Getenv("ENABLE_AUTO_RESTART"))
+	delay, _ := strconv.ParseInt(env["KILL_OLD_DELAY"], 10, 0)
+	autoRestart, _ := strconv.ParseBool(env["ENABLE_AUTO_RESTART"])
 	if autoRestart && delay == 0 {
 		delay = 5
 	}
@@ -463,47 +614,105 @@ func (s *Starter) StartWorker(sigCh chan os.Signal, ch chan processState) *os.Pr
 		if s.dir != "" {
 			cmd.Dir = s.dir
 		}
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		out := s.openWorkerOutput()
+		cmd.Stdout = out.stdout
+		cmd.Stderr = out.stderr
 
 		// This whole section here basically sets up the env
 		// var and the file descriptors that are inherited by the
 		// external process
-		files := make([]*os.File, len(s.ports)+len(s.paths))
-		ports := make([]string, len(s.ports)+len(s.paths))
+		files := make([]*os.File, len(s.listeners))
 		for i, l := range s.listeners {
+			// Slots left empty by a reload stay closed in the worker,
+			// so the remaining listeners keep their fd numbers
+			if l.listener == nil {
+				continue
+			}
+
 			// file descriptor numbers in ExtraFiles turn out to be
 			// index + 3, so we can just hard code it
-			var f *os.File
-			var err error
-			switch l.listener.(type) {
-			case *net.TCPListener:
-				f, err = l.listener.(*net.TCPListener).File()
-			case *net.UnixListener:
-				f, err = l.listener.(*net.UnixListener).File()
-			default:
-				panic("Unknown listener type")
-			}
+			f, err := listenerFile(l.listener)
 			if err != nil {
 				panic(err)
 			}
-			defer f.Close()
-			ports[i] = fmt.Sprintf("%s=%d", l.spec, i+3)
 			files[i] = f
 		}
 		cmd.ExtraFiles = files
 
+		// The worker has its own copies once started. Nothing is
+		// deferred, as this loop may go on for a long time
+		var cgroup *os.File
+		release := func() {
+			for _, f := range files {
+				if f != nil {
+					f.Close()
+				}
+			}
+			if cgroup != nil {
+				cgroup.Close()
+			}
+		}
+
 		s.generation++
-		os.Setenv("SERVER_STARTER_PORT", strings.Join(ports, ";"))
-		os.Setenv("SERVER_STARTER_GENERATION", fmt.Sprintf("%d", s.generation))
+		cmd.Env = s.workerEnviron()
+
+		cmd.SysProcAttr = s.sysProcAttr()
+
+		var rlimits *rlimitPipe
+		if len(s.rlimits) > 0 {
+			p, err := s.useRlimitHelper(cmd)
+			if err != nil {
+				out.abort()
+				s.logger.Log(logger.Error, fmt.Sprintf("failed to prepare the resource limits of generation %d: %s", s.generation, err),
+					logger.F("generation", s.generation))
+				s.metrics.workerFailed()
+				release()
+				time.Sleep(s.interval)
+				continue
+			}
+			rlimits = p
+		}
+
+		if s.cgroup.path != "" {
+			f, err := s.openCgroup(s.generation)
+			if err != nil {
+				s.logger.Log(logger.Warning, fmt.Sprintf("failed to create cgroup, starting generation %d outside of it: %s", s.generation, err),
+					logger.F("generation", s.generation))
+			} else {
+				useCgroup(cmd.SysProcAttr, f)
+				cgroup = f
+			}
+		}
 
 		// Now start!
-		if err := cmd.Start(); err != nil {
-			s.logger.Printf("failed to exec %s: %s", cmd.Path, err)
+		err := cmd.Start()
+		rerr := rlimits.wait(err == nil)
+		release()
+		if err == nil && rerr != nil {
+			pid = cmd.Process.Pid
+			out.abort()
+			s.logger.Log(logger.Error, fmt.Sprintf("worker %d failed to start: %s", pid, rerr),
+				logger.F("pid", pid), logger.F("generation", s.generation))
+			// Most likely it fails the same way again, so don't hurry
+			time.Sleep(s.interval)
+		} else if err != nil {
+			if cgroup != nil {
+				// Most likely we can't move processes there. Don't
+				// insist, so that the next attempt has a chance
+				s.logger.Log(logger.Warning, fmt.Sprintf("failed to start worker in cgroup %s, disabling cgroups: %s", s.cgroup.path, err))
+				s.removeCgroup(s.generation)
+				s.cgroup.path = ""
+			}
+			out.abort()
+			s.logger.Log(logger.Error, fmt.Sprintf("failed to exec %s: %s", cmd.Path, err),
+				logger.F("generation", s.generation))
+			s.metrics.workerFailed()
 		} else {
 			// Save pid...
 			pid = cmd.Process.Pid
-			s.logger.Printf("starting new worker %d", pid)
+			s.workerStarted(out, pid, s.generation)
+			s.logger.Log(logger.Info, fmt.Sprintf("starting new worker %d", pid),
+				logger.F("pid", pid), logger.F("generation", s.generation))
 
 			// Wait for interval before checking if the process is alive
 			tch := time.After(s.interval)
@@ -546,6 +755,11 @@ func (s *Starter) StartWorker(sigCh chan os.Signal, ch chan processState) *os.Pr
 						ch <- &dummyProcessState{pid: pid, status: successStatus}
 					}
 				}()
+				if s.subreaper {
+					s.pgroups[pid] = s.generation
+				}
+				s.metrics.workerSpawned()
+				s.metrics.setWorkers(s.generation, 0)
 				// Bail out
 				return p
 			}
@@ -554,11 +768,13 @@ func (s *Starter) StartWorker(sigCh chan os.Signal, ch chan processState) *os.Pr
 		// If we fall through here, we prematurely exited :/
 		// Make sure to wait to release resources
 		cmd.Wait()
-		for _, f := range cmd.ExtraFiles {
-			f.Close()
-		}
+		s.removeCgroup(s.generation)
 
-		s.logger.Printf("new worker %d seems to have failed to start", pid)
+		s.logger.Log(logger.Error, fmt.Sprintf("new worker %d seems to have failed to start", pid),
+			logger.F("pid", pid), logger.F("generation", s.generation))
+		if pid != -1 {
+			s.metrics.workerFailed()
+		}
 	}
 
 	// never reached
@@ -566,17 +782,40 @@ func (s *Starter) StartWorker(sigCh chan os.Signal, ch chan processState) *os.Pr
 }
 
 func (s *Starter) Teardown() error {
-	if s.pidFile != "" {
-		os.Remove(s.pidFile)
-	}
+	s.unlockPidFile()
 
 	if s.statusFile != "" {
 		os.Remove(s.statusFile)
 	}
 
 	for _, l := range s.listeners {
-		l.listener.Close()
+		if l.listener != nil {
+			l.listener.Close()
+		}
+	}
+
+	if s.workerFile != nil {
+		s.workerFile.Close()
+	}
+
+	if s.metricsLn != nil {
+		s.metricsLn.Close()
 	}
 
 	return nil
 }
+
+// reopenLogs reopens the files we log to, for when they have been moved
+// away by an external log rotation
+func (s *Starter) reopenLogs() {
+	if r, ok := s.logger.(logger.Reopener); ok {
+		if err := r.Reopen(); err != nil {
+			s.logger.Log(logger.Error, fmt.Sprintf("failed to reopen log file: %s", err))
+		}
+	}
+	if s.workerFile != nil {
+		if err := s.workerFile.Reopen(); err != nil {
+			s.logger.Log(logger.Error, fmt.Sprintf("failed to reopen worker log %s: %s", s.workerLog, err))
+		}
+	}
+}
@@ -4,6 +4,9 @@ package starter
 
 import "syscall"
 
+// reopenSignal makes start_server reopen its log files
+const reopenSignal = syscall.SIGUSR1
+
 func init() {
 	failureStatus = syscall.WaitStatus(255)
 	successStatus = syscall.WaitStatus(0)
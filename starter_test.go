@@ -11,8 +11,11 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/lestrrat/go-server-starter/logger"
 )
 
 var echoServerTxt = `package main
@@ -60,18 +63,36 @@ type config struct {
 	args       []string
 	command    string
 	dir        string
+	envdir     string
+	envfiles   []string
+	redactenv  []string
 	interval   int
 	pidfile    string
 	ports      []string
 	paths      []string
+	sdsockets  []string
 	sigonhup   string
 	sigonterm  string
 	statusfile string
+	workerlog  string
+	rlimits    []string
+	cgroup     string
+	user       string
+	group      string
+	groups     []string
+	chroot     string
+	watchdog   string
+	subreaper  bool
+	sigondeath string
+	restart    string
 }
 
 func (c config) Args() []string          { return c.args }
 func (c config) Command() string         { return c.command }
 func (c config) Dir() string             { return c.dir }
+func (c config) Envdir() string          { return c.envdir }
+func (c config) EnvFiles() []string      { return c.envfiles }
+func (c config) RedactEnv() []string     { return c.redactenv }
 func (c config) Interval() time.Duration { return time.Duration(c.interval) * time.Second }
 func (c config) PidFile() string         { return c.pidfile }
 func (c config) Ports() []string         { return c.ports }
@@ -79,6 +100,59 @@ func (c config) Paths() []string         { return c.paths }
 func (c config) SignalOnHUP() os.Signal  { return SigFromName(c.sigonhup) }
 func (c config) SignalOnTERM() os.Signal { return SigFromName(c.sigonterm) }
 func (c config) StatusFile() string      { return c.statusfile }
+func (c config) WorkerLog() string       { return c.workerlog }
+func (c config) Logger() logger.Logger   { return logger.NewStderr() }
+
+func (c config) LogRotation() logger.FileOptions { return logger.FileOptions{} }
+func (c config) MetricsAddr() string             { return "" }
+func (c config) Rlimits() []string               { return c.rlimits }
+func (c config) Cgroup() string                  { return c.cgroup }
+func (c config) User() string                    { return c.user }
+func (c config) Group() string                   { return c.group }
+func (c config) Groups() []string                { return c.groups }
+func (c config) Chroot() string                  { return c.chroot }
+func (c config) Watchdog() string                { return c.watchdog }
+func (c config) ChildSubreaper() bool            { return c.subreaper }
+func (c config) SignalOnParentDeath() os.Signal  { return SigFromName(c.sigondeath) }
+func (c config) RestartPolicy() string           { return c.restart }
+func (c config) SystemdSockets() []string        { return c.sdsockets }
+
+func TestParsePortSpec(t *testing.T) {
+	ps, err := parsePortSpec("127.0.0.1:8080,backlog=1024,reuseport,defer_accept,keepalive=30")
+	if err != nil {
+		t.Fatalf("parsePortSpec failed: %s", err)
+	}
+	if ps.host != "127.0.0.1" || ps.port != 8080 {
+		t.Errorf("Expected 127.0.0.1:8080, got %s:%d", ps.host, ps.port)
+	}
+	expect := socketOptions{
+		backlog:     1024,
+		reusePort:   true,
+		deferAccept: 1,
+		keepAlive:   30 * time.Second,
+		keepAliveOn: true,
+	}
+	if ps.opts != expect {
+		t.Errorf("Expected options %#v, got %#v", expect, ps.opts)
+	}
+	if ps.String() != "127.0.0.1:8080" {
+		t.Errorf("Expected spec to be advertised without options, got '%s'", ps.String())
+	}
+
+	ps, err = parsePortSpec("[::1]:8080,v6only")
+	if err != nil {
+		t.Fatalf("parsePortSpec failed: %s", err)
+	}
+	if ps.network() != "tcp6" || ps.String() != "[::1]:8080" {
+		t.Errorf("Expected tcp6 [::1]:8080, got %s %s", ps.network(), ps)
+	}
+
+	for _, spec := range []string{"8080,backlog", "8080,backlog=-1", "8080,nosuchopt", "8080,reuseport=1", "foo"} {
+		if _, err := parsePortSpec(spec); err == nil {
+			t.Errorf("Expected parsePortSpec('%s') to fail", spec)
+		}
+	}
+}
 
 func TestRun(t *testing.T) {
 	dir, err := ioutil.TempDir("", fmt.Sprintf("server-starter-test-%d", os.Getpid()))
@@ -147,8 +221,36 @@ func TestRun(t *testing.T) {
 	}
 	pattern := regexp.MustCompile(strings.Join(patterns, ";"))
 
-	if envPort := os.Getenv("SERVER_STARTER_PORT"); !pattern.MatchString(envPort) {
+	if envPort := sd.portsEnv(); !pattern.MatchString(envPort) {
 		t.Errorf("SERVER_STARTER_PORT: Expected '%s', but got '%s'", pattern, envPort)
 	}
 
 }
+
+func TestParsePathSpec(t *testing.T) {
+	ps, err := parsePathSpec("/tmp/app.sock,mode=0660,owner=0,group=0")
+	if err != nil {
+		t.Fatalf("parsePathSpec failed: %s", err)
+	}
+	expect := pathSpec{path: "/tmp/app.sock", mode: 0660, hasMode: true, uid: 0, gid: 0}
+	if ps != expect {
+		t.Errorf("Expected %#v, got %#v", expect, ps)
+	}
+
+	for _, spec := range []string{"/tmp/app.sock,mode=999", "/tmp/app.sock,mode", "/tmp/app.sock,color=red", "@app.sock,mode=0600"} {
+		if _, err := parsePathSpec(spec); err == nil {
+			t.Errorf("Expected parsePathSpec('%s') to fail", spec)
+		}
+	}
+}
+
+func TestSigFromName(t *testing.T) {
+	for _, name := range []string{"TERM", "SIGTERM", "term"} {
+		if sig := SigFromName(name); sig != syscall.SIGTERM {
+			t.Errorf("SigFromName(%q): expected SIGTERM, got %v", name, sig)
+		}
+	}
+	if sig := SigFromName("NOPE"); sig != nil {
+		t.Errorf("Expected unknown signal to be nil, got %v", sig)
+	}
+}
@@ -2,6 +2,9 @@ package starter
 
 import "syscall"
 
+// reopenSignal is never delivered on windows
+const reopenSignal = syscall.Signal(-2)
+
 func init() {
 	failureStatus = syscall.WaitStatus{ExitCode: 255}
 	successStatus = syscall.WaitStatus{ExitCode: 0}
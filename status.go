@@ -0,0 +1,164 @@
+package starter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+// workerStatus is a snapshot of the workers of a Starter, for those
+// asking about them from other goroutines
+type workerStatus struct {
+	mu         sync.Mutex
+	pid        int
+	generation int
+	oldWorkers int
+}
+
+func (ws *workerStatus) set(worker *os.Process, generation int, oldWorkers map[int]int) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.pid = 0
+	if worker != nil {
+		ws.pid = worker.Pid
+	}
+	ws.generation = generation
+	ws.oldWorkers = len(oldWorkers)
+}
+
+func (ws *workerStatus) get() (pid, generation, oldWorkers int) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.pid, ws.generation, ws.oldWorkers
+}
+
+// writeStatusFile records the generation and pid of every worker, one
+// "generation:pid" line each, oldest first. The file is replaced
+// atomically so that readers never see it half written
+func (s *Starter) writeStatusFile(worker *os.Process, oldWorkers map[int]int) {
+	if s.statusFile == "" {
+		return
+	}
+
+	wmap := map[int]int{s.generation: worker.Pid}
+	for pid, gen := range oldWorkers {
+		wmap[gen] = pid
+	}
+	gens := make([]int, 0, len(wmap))
+	for gen := range wmap {
+		gens = append(gens, gen)
+	}
+	sort.Ints(gens)
+
+	var buf bytes.Buffer
+	for _, gen := range gens {
+		fmt.Fprintf(&buf, "%d:%d\n", gen, wmap[gen])
+	}
+
+	tmp := s.statusFile + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		s.logger.Log(logger.Error, fmt.Sprintf("failed to write status file %s: %s", s.statusFile, err))
+		return
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.statusFile)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		s.logger.Log(logger.Error, fmt.Sprintf("failed to write status file %s: %s", s.statusFile, err))
+	}
+}
+
+// readStatusFile returns the pids listed in a status file, by generation
+func readStatusFile(fn string) (map[int]int, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	workers := make(map[int]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		gen, err1 := strconv.Atoi(parts[0])
+		pid, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || pid <= 1 {
+			continue
+		}
+		workers[gen] = pid
+	}
+	return workers, scanner.Err()
+}
+
+// killStaleWorkers terminates the workers left running by a previous
+// start_server that did not exit cleanly, as they would hold on to the
+// ports we are about to bind. Only processes that still run our command
+// are signalled, since their pids may have been reused since
+func (s *Starter) killStaleWorkers() {
+	if s.statusFile == "" {
+		return
+	}
+	workers, err := readStatusFile(s.statusFile)
+	if err != nil {
+		return
+	}
+
+	var stale []int
+	for gen, pid := range workers {
+		cmd, err := procCommand(pid)
+		if err != nil {
+			continue
+		}
+		_, ppid, _, err := readProcParent(pid)
+		if err != nil {
+			continue
+		}
+		if ppid != 1 && isStarter(ppid) {
+			s.logger.Log(logger.Warning, fmt.Sprintf("not killing process %d listed in %s, as its start_server %d is still running", pid, s.statusFile, ppid),
+				logger.F("pid", pid))
+			continue
+		}
+		if cmd != s.command && filepath.Base(cmd) != filepath.Base(s.command) {
+			s.logger.Log(logger.Warning, fmt.Sprintf("not killing process %d listed in %s, as it runs %s", pid, s.statusFile, cmd),
+				logger.F("pid", pid))
+			continue
+		}
+		s.logger.Log(logger.Warning, fmt.Sprintf("killing stale worker %d of generation %d left by a previous start_server", pid, gen),
+			logger.F("pid", pid), logger.F("generation", gen))
+		signalWorker(pid, syscall.SIGTERM)
+		stale = append(stale, pid)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, pid := range stale {
+		for time.Now().Before(deadline) {
+			if _, err := procCommand(pid); err != nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if _, err := procCommand(pid); err == nil {
+			s.logger.Log(logger.Warning, fmt.Sprintf("stale worker %d did not exit, sending KILL", pid), logger.F("pid", pid))
+			signalWorker(pid, syscall.SIGKILL)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package starter
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+func TestKillStaleWorkers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The worker's parent is a shell rather than a start_server
+	sh := exec.Command("/bin/sh", "-c", "sleep 30 & echo $!; wait")
+	out, err := sh.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %s", err)
+	}
+	if err := sh.Start(); err != nil {
+		t.Fatalf("Failed to start shell: %s", err)
+	}
+	defer func() {
+		sh.Process.Kill()
+		sh.Wait()
+	}()
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read pid: %s", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("Unexpected output %q", line)
+	}
+
+	// The shell may not have exec'd sleep yet
+	for i := 0; i < 50; i++ {
+		if cmd, _ := procCommand(pid); cmd == "sleep" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	fn := filepath.Join(dir, "status")
+	ioutil.WriteFile(fn, []byte(fmt.Sprintf("1:%d\n", pid)), 0644)
+
+	// A pid that now runs something else is left alone
+	s := &Starter{logger: logger.Leveled(&bufferLogger{}), statusFile: fn, command: "cat"}
+	s.killStaleWorkers()
+	if _, err := procCommand(pid); err != nil {
+		t.Fatalf("Expected process running another command to be left alone")
+	}
+
+	s.command = "/bin/sleep"
+	s.killStaleWorkers()
+	if err := sh.Wait(); err != nil {
+		t.Errorf("Shell failed: %s", err)
+	}
+	if _, err := procCommand(pid); err == nil {
+		t.Errorf("Expected stale worker to be killed")
+	}
+}
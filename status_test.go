@@ -0,0 +1,39 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+func TestStatusFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "status")
+	s := &Starter{logger: logger.Leveled(&bufferLogger{}), statusFile: fn, generation: 3}
+	s.writeStatusFile(&os.Process{Pid: 300}, map[int]int{100: 1, 200: 2})
+
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("Failed to read status file: %s", err)
+	}
+	if string(buf) != "1:100\n2:200\n3:300\n" {
+		t.Errorf("Unexpected status file %q", buf)
+	}
+
+	workers, err := readStatusFile(fn)
+	if err != nil {
+		t.Fatalf("Failed to read status file: %s", err)
+	}
+	if expect := map[int]int{1: 100, 2: 200, 3: 300}; !reflect.DeepEqual(workers, expect) {
+		t.Errorf("Expected %v, got %v", expect, workers)
+	}
+}
@@ -0,0 +1,97 @@
+package starter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+const childSubreaperSupported = true
+
+// Not defined by the syscall package
+const _PR_SET_CHILD_SUBREAPER = 0x24
+
+// setChildSubreaper makes the processes orphaned by the workers our
+// children, instead of init's
+func setChildSubreaper() error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, _PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// reapOrphans waits for the zombies among the processes that were
+// reparented to us. workers are the pids that are waited for elsewhere.
+// Orphans are attributed to the generation of their process group
+func (s *Starter) reapOrphans(workers map[int]bool) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return
+	}
+
+	self := os.Getpid()
+	alive := make(map[int]bool)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || workers[pid] {
+			continue
+		}
+		state, ppid, pgid, err := readProcParent(pid)
+		if err != nil || ppid != self {
+			continue
+		}
+		if state != "Z" {
+			alive[pgid] = true
+			continue
+		}
+
+		var ws syscall.WaitStatus
+		if wpid, err := syscall.Wait4(pid, &ws, syscall.WNOHANG, nil); err != nil || wpid != pid {
+			continue
+		}
+		gen, ok := s.pgroups[pgid]
+		if !ok {
+			gen = -1
+		}
+		s.logger.Log(logger.Info, fmt.Sprintf("reaped orphan %d of generation %d, status:%d", pid, gen, ws),
+			logger.F("pid", pid), logger.F("generation", gen), logger.F("status", int(ws)))
+	}
+
+	// Forget about the groups whose leader and orphans are all gone
+	for pgid := range s.pgroups {
+		if !workers[pgid] && !alive[pgid] {
+			delete(s.pgroups, pgid)
+		}
+	}
+}
+
+// readProcParent returns the state, parent pid and process group of pid
+func readProcParent(pid int) (string, int, int, error) {
+	stat, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", 0, 0, err
+	}
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return "", 0, 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 3 {
+		return "", 0, 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return "", 0, 0, err
+	}
+	pgid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return fields[0], ppid, pgid, nil
+}
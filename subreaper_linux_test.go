@@ -0,0 +1,52 @@
+package starter
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+func TestReapOrphans(t *testing.T) {
+	if err := setChildSubreaper(); err != nil {
+		t.Skipf("Failed to become a child subreaper: %s", err)
+	}
+
+	// The shell exits right away, leaving sleep to us
+	cmd := exec.Command("/bin/sh", "-c", "sleep 0.2 & echo $!")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to run shell: %s", err)
+	}
+	orphan, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		t.Fatalf("Unexpected output %q", out)
+	}
+	if _, ppid, _, err := readProcParent(orphan); err != nil || ppid != os.Getpid() {
+		t.Fatalf("Expected %d to be our child, got parent %d (%v)", orphan, ppid, err)
+	}
+
+	var l bufferLogger
+	s := &Starter{logger: logger.Leveled(&l), pgroups: map[int]int{cmd.Process.Pid: 3}}
+	expect := "reaped orphan " + strconv.Itoa(orphan) + " of generation 3, status:0"
+	reaped := false
+	for i := 0; i < 50 && !reaped; i++ {
+		time.Sleep(50 * time.Millisecond)
+		s.reapOrphans(map[int]bool{})
+		for _, line := range l {
+			reaped = reaped || line == expect
+		}
+	}
+	if !reaped {
+		t.Errorf("Expected %q, got %#v", expect, l)
+	}
+	if len(s.pgroups) != 0 {
+		t.Errorf("Expected the process group to be forgotten, got %v", s.pgroups)
+	}
+}
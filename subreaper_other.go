@@ -0,0 +1,17 @@
+// +build !linux
+
+package starter
+
+import "errors"
+
+const childSubreaperSupported = false
+
+func setChildSubreaper() error {
+	return errors.New("not supported on this platform")
+}
+
+func (s *Starter) reapOrphans(workers map[int]bool) {}
+
+func readProcParent(pid int) (string, int, int, error) {
+	return "", 0, 0, errors.New("not supported on this platform")
+}
@@ -0,0 +1,341 @@
+package starter
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+// Service is a program run by a Supervisor, under the name it is
+// addressed by in control commands
+type Service struct {
+	Name   string
+	Config Config
+}
+
+type SupervisorConfig interface {
+	Services() []Service
+	PidFile() string
+	ControlSocket() string // Path of the UNIX socket to accept control commands at, if any
+	Logger() logger.Logger
+}
+
+// Supervisor runs several services in one start_server, each with a
+// Starter of its own. The signals start_server receives are passed on
+// to every service, and single services are started, stopped and
+// restarted through control commands
+type Supervisor struct {
+	services  []*service
+	pidFile   string
+	pidLock   *os.File
+	control   string
+	controlLn net.Listener
+	logger    logger.LeveledLogger
+	sigCh     chan os.Signal
+	ctlCh     chan controlRequest
+	doneCh    chan serviceExit
+	quit      chan struct{}
+}
+
+// service states, as shown by the status command
+const (
+	serviceRunning  = "running"
+	serviceStopping = "stopping"
+	serviceStopped  = "stopped"
+	serviceExited   = "exited"
+	serviceFailed   = "failed"
+)
+
+type service struct {
+	name    string
+	config  Config
+	starter *Starter
+	state   string
+	err     error          // why the service failed
+	signals chan os.Signal // passed on to the starter
+	done    chan struct{}  // closed when the starter returns
+}
+
+type serviceExit struct {
+	svc *service
+	err error
+}
+
+// NewSupervisor creates a Supervisor for the services of c, checking
+// their configuration as NewStarter does
+func NewSupervisor(c SupervisorConfig) (*Supervisor, error) {
+	if len(c.Services()) == 0 {
+		return nil, fmt.Errorf("no services specified")
+	}
+
+	sv := &Supervisor{
+		pidFile: c.PidFile(),
+		control: c.ControlSocket(),
+		logger:  logger.Leveled(c.Logger()),
+		sigCh:   make(chan os.Signal, 1),
+		ctlCh:   make(chan controlRequest),
+		doneCh:  make(chan serviceExit),
+		quit:    make(chan struct{}),
+	}
+
+	names := make(map[string]bool)
+	for _, svcConfig := range c.Services() {
+		name := svcConfig.Name
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			return nil, fmt.Errorf("invalid service name %q", name)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate service %s", name)
+		}
+		names[name] = true
+
+		// These concern the whole process, and belong to the Supervisor
+		if svcConfig.Config.PidFile() != "" {
+			return nil, fmt.Errorf("service %s: pid file can not be set for a service", name)
+		}
+		if svcConfig.Config.ChildSubreaper() {
+			return nil, fmt.Errorf("service %s: child subreaper can not be used with multiple services", name)
+		}
+
+		s, err := NewStarter(svcConfig.Config)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %s", name, err)
+		}
+		sv.services = append(sv.services, &service{
+			name:    name,
+			config:  svcConfig.Config,
+			starter: s,
+			state:   serviceStopped,
+		})
+	}
+
+	return sv, nil
+}
+
+// Stop stops all services and the Supervisor, as SIGTERM does
+func (sv *Supervisor) Stop() {
+	go func() { sv.sigCh <- syscall.SIGTERM }()
+}
+
+func (sv *Supervisor) Run() error {
+	if sv.pidFile != "" {
+		f, err := acquirePidFile(sv.pidFile)
+		if err != nil {
+			sv.logger.Log(logger.Error, err.Error())
+			return err
+		}
+		sv.pidLock = f
+	}
+	defer sv.Teardown()
+
+	if sv.control != "" {
+		ln, err := listenControl(sv.control)
+		if err != nil {
+			sv.logger.Log(logger.Error, fmt.Sprintf("failed to listen to control socket %s: %s", sv.control, err))
+			return err
+		}
+		sv.controlLn = ln
+		go sv.serveControl(ln)
+	}
+
+	signal.Notify(sv.sigCh,
+		syscall.SIGHUP,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT,
+		upgradeSignal,
+		reopenSignal,
+	)
+
+	for _, svc := range sv.services {
+		if err := sv.startService(svc); err != nil {
+			svc.state = serviceFailed
+			svc.err = err
+			sv.logger.Log(logger.Error, fmt.Sprintf("failed to start service %s: %s", svc.name, err))
+		}
+	}
+
+	stopping := false
+	for {
+		if stopping && !sv.running() {
+			sv.logger.Log(logger.Notice, "exiting")
+			return nil
+		}
+
+		// Without a control socket, nothing can start them again
+		if sv.controlLn == nil && !sv.running() {
+			sv.logger.Log(logger.Notice, "all services have stopped, exiting")
+			return sv.failure()
+		}
+
+		select {
+		case sig := <-sv.sigCh:
+			switch sig {
+			case upgradeSignal:
+				sv.logger.Log(logger.Warning, fmt.Sprintf("received %s, but start_server can not upgrade itself when running multiple services", signame(sig)),
+					logger.F("signal", signame(sig)))
+			case syscall.SIGHUP:
+				sv.logger.Log(logger.Notice, "received HUP, restarting all services", logger.F("signal", "HUP"))
+				sv.signalServices(sig)
+			case reopenSignal:
+				sv.logger.Log(logger.Info, fmt.Sprintf("received %s, reopening log files", signame(sig)),
+					logger.F("signal", signame(sig)))
+				if r, ok := sv.logger.(logger.Reopener); ok {
+					if err := r.Reopen(); err != nil {
+						sv.logger.Log(logger.Error, fmt.Sprintf("failed to reopen log file: %s", err))
+					}
+				}
+				sv.signalServices(sig)
+			default:
+				sv.logger.Log(logger.Notice, fmt.Sprintf("received %s, stopping all services", signame(sig)),
+					logger.F("signal", signame(sig)))
+				stopping = true
+				for _, svc := range sv.services {
+					if svc.state == serviceRunning {
+						svc.state = serviceStopping
+					}
+				}
+				sv.signalServices(sig)
+			}
+		case exit := <-sv.doneCh:
+			svc := exit.svc
+			switch {
+			case svc.state == serviceStopping:
+				svc.state = serviceStopped
+			case exit.err != nil:
+				svc.state = serviceFailed
+				svc.err = exit.err
+				sv.logger.Log(logger.Error, fmt.Sprintf("service %s failed: %s", svc.name, exit.err))
+			default:
+				svc.state = serviceExited
+				sv.logger.Log(logger.Notice, fmt.Sprintf("service %s exited", svc.name))
+			}
+			svc.starter = nil
+		case req := <-sv.ctlCh:
+			req.reply <- sv.handleCommand(req.args, stopping)
+		}
+	}
+}
+
+// failure returns an error naming the services that failed, if any
+func (sv *Supervisor) failure() error {
+	var failed []string
+	for _, svc := range sv.services {
+		if svc.state == serviceFailed {
+			failed = append(failed, svc.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("service(s) failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Teardown releases what Run acquired for the Supervisor. Each service
+// cleans up after itself when it stops
+func (sv *Supervisor) Teardown() error {
+	close(sv.quit)
+	if sv.controlLn != nil {
+		sv.controlLn.Close()
+		os.Remove(sv.control)
+	}
+	if sv.pidLock != nil {
+		releasePidFile(sv.pidFile, sv.pidLock)
+		sv.pidLock = nil
+	}
+	return nil
+}
+
+// running reports whether any service has yet to return
+func (sv *Supervisor) running() bool {
+	for _, svc := range sv.services {
+		if svc.state == serviceRunning || svc.state == serviceStopping {
+			return true
+		}
+	}
+	return false
+}
+
+// startService runs the Starter of svc, creating a new one if it has
+// run before. Its configuration is reloaded first, if supported
+func (sv *Supervisor) startService(svc *service) error {
+	if svc.starter == nil {
+		if r, ok := svc.config.(Reloader); ok {
+			c, err := r.Reload()
+			if err != nil {
+				return err
+			}
+			svc.config = c
+		}
+		s, err := NewStarter(svc.config)
+		if err != nil {
+			return err
+		}
+		svc.starter = s
+	}
+
+	svc.state = serviceRunning
+	svc.err = nil
+	svc.signals = make(chan os.Signal, 1)
+	svc.done = make(chan struct{})
+	svc.starter.signals = svc.signals
+
+	s, done := svc.starter, svc.done
+	go func() {
+		err := s.Run()
+		close(done)
+		sv.doneCh <- serviceExit{svc: svc, err: err}
+	}()
+	return nil
+}
+
+// signalService passes sig on to the Starter of svc, unless it has
+// returned in the meantime
+func (sv *Supervisor) signalService(svc *service, sig os.Signal) {
+	if svc.state != serviceRunning && svc.state != serviceStopping {
+		return
+	}
+	ch, done := svc.signals, svc.done
+	go func() {
+		select {
+		case ch <- sig:
+		case <-done:
+		}
+	}()
+}
+
+func (sv *Supervisor) signalServices(sig os.Signal) {
+	for _, svc := range sv.services {
+		sv.signalService(svc, sig)
+	}
+}
+
+func (sv *Supervisor) findService(name string) *service {
+	for _, svc := range sv.services {
+		if svc.name == name {
+			return svc
+		}
+	}
+	return nil
+}
+
+// statusLine describes the state of svc, along with its workers when
+// it is running
+func (svc *service) statusLine() string {
+	switch svc.state {
+	case serviceRunning, serviceStopping:
+		pid, gen, old := svc.starter.status.get()
+		if pid == 0 {
+			return fmt.Sprintf("%s %s", svc.name, svc.state)
+		}
+		return fmt.Sprintf("%s %s pid=%d generation=%d old_workers=%d", svc.name, svc.state, pid, gen, old)
+	case serviceFailed:
+		return fmt.Sprintf("%s %s: %s", svc.name, svc.state, svc.err)
+	}
+	return fmt.Sprintf("%s %s", svc.name, svc.state)
+}
@@ -0,0 +1,158 @@
+// +build !windows
+
+package starter
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+type supervisorConfig struct {
+	services []Service
+	pidfile  string
+	control  string
+}
+
+func (c supervisorConfig) Services() []Service   { return c.services }
+func (c supervisorConfig) PidFile() string       { return c.pidfile }
+func (c supervisorConfig) ControlSocket() string { return c.control }
+func (c supervisorConfig) Logger() logger.Logger { return logger.NewStderr() }
+
+func TestNewSupervisor(t *testing.T) {
+	svc := &config{command: "sleep"}
+	for _, services := range [][]Service{
+		nil,
+		{{Name: "web", Config: svc}, {Name: "web", Config: svc}},
+		{{Name: "my web", Config: svc}},
+		{{Name: "web", Config: &config{command: "sleep", pidfile: "/tmp/web.pid"}}},
+		{{Name: "web", Config: &config{command: "sleep", subreaper: true}}},
+		{{Name: "web", Config: &config{command: "sleep", restart: "sometimes"}}},
+	} {
+		if _, err := NewSupervisor(supervisorConfig{services: services}); err == nil {
+			t.Errorf("Expected NewSupervisor to fail for %#v", services)
+		}
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctl := filepath.Join(dir, "ctl.sock")
+	sv, err := NewSupervisor(supervisorConfig{
+		services: []Service{
+			{Name: "web", Config: &config{command: "sleep", args: []string{"100"}}},
+			{Name: "job", Config: &config{command: "true", restart: "never"}},
+		},
+		pidfile: filepath.Join(dir, "pid"),
+		control: ctl,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create supervisor: %s", err)
+	}
+
+	doneCh := make(chan error)
+	go func() { doneCh <- sv.Run() }()
+
+	// Waits for the status to match, as services change state on their own
+	waitStatus := func(cmd string, pattern string) {
+		re := regexp.MustCompile(pattern)
+		var reply string
+		for i := 0; i < 50; i++ {
+			reply, _ = Control(ctl, cmd)
+			if re.MatchString(reply) {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("Expected %q to reply %s, got %q", cmd, pattern, reply)
+	}
+
+	waitStatus("status", `^web running pid=\d+ generation=1 old_workers=0\njob exited\n$`)
+
+	if reply, err := Control(ctl, "stop web"); err != nil || reply != "web stopping\n" {
+		t.Errorf("Expected web to be stopped, got %q (%v)", reply, err)
+	}
+	waitStatus("status web", `^web stopped\n$`)
+
+	if reply, err := Control(ctl, "restart web"); err != nil || reply != "web starting\n" {
+		t.Errorf("Expected web to be started, got %q (%v)", reply, err)
+	}
+	waitStatus("status web", `^web running pid=\d+ generation=1`)
+
+	if reply, err := Control(ctl, "restart web"); err != nil || reply != "web restarting\n" {
+		t.Errorf("Expected web to be restarted, got %q (%v)", reply, err)
+	}
+	waitStatus("status web", `^web running pid=\d+ generation=2 old_workers=0\n$`)
+
+	for _, cmd := range []string{"", "frobnicate web", "stop", "stop nosuch", "stop job"} {
+		if reply, err := Control(ctl, cmd); err == nil || !strings.HasPrefix(reply, "error: ") {
+			t.Errorf("Expected %q to fail, got %q", cmd, reply)
+		}
+	}
+
+	sv.Stop()
+	select {
+	case err := <-doneCh:
+		if err != nil {
+			t.Errorf("Run failed: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Supervisor did not stop")
+	}
+
+	for _, fn := range []string{ctl, filepath.Join(dir, "pid")} {
+		if _, err := os.Stat(fn); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", fn)
+		}
+	}
+}
+
+func TestSupervisorExits(t *testing.T) {
+	// A port in use makes the service fail
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer l.Close()
+
+	for _, c := range []struct {
+		services []Service
+		fail     bool
+	}{
+		{[]Service{{Name: "job", Config: &config{command: "true", restart: "never"}}}, false},
+		{[]Service{
+			{Name: "job", Config: &config{command: "true", restart: "never"}},
+			{Name: "web", Config: &config{command: "sleep", args: []string{"100"}, ports: []string{l.Addr().String()}}},
+		}, true},
+	} {
+		sv, err := NewSupervisor(supervisorConfig{services: c.services})
+		if err != nil {
+			t.Fatalf("Failed to create supervisor: %s", err)
+		}
+
+		doneCh := make(chan error)
+		go func() { doneCh <- sv.Run() }()
+		select {
+		case err := <-doneCh:
+			if c.fail != (err != nil) {
+				t.Errorf("Expected Run to fail: %t, got %v", c.fail, err)
+			}
+		case <-time.After(10 * time.Second):
+			sv.Stop()
+			<-doneCh
+			t.Errorf("Expected the supervisor to exit once no service is running")
+		}
+	}
+}
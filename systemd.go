@@ -0,0 +1,98 @@
+// +build !windows
+
+package starter
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// sdListenFdsStart is the first file descriptor passed by systemd
+const sdListenFdsStart = 3
+
+// systemdListeners adopts the sockets passed through systemd socket
+// activation (LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES). It returns nil
+// when the variables are not set, or are meant for another process.
+// The variables are removed from the environment, so that they are not
+// passed down to the workers
+func systemdListeners() ([]listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	var names []string
+	if v := os.Getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	ret := make([]listener, 0, n)
+	fail := func(err error) ([]listener, error) {
+		for _, l := range ret {
+			l.listener.Close()
+		}
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		fd := sdListenFdsStart + i
+		syscall.CloseOnExec(fd)
+
+		spec, err := socketSpec(fd)
+		if err != nil {
+			return fail(fmt.Errorf("systemd socket fd %d: %s", fd, err))
+		}
+		name := spec
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return fail(fmt.Errorf("systemd socket fd %d: %s", fd, err))
+		}
+		ret = append(ret, listener{listener: l, spec: spec, config: name, adopted: true})
+	}
+	return ret, nil
+}
+
+// socketSpec returns the spec under which the listening socket fd is
+// advertised in SERVER_STARTER_PORT: a bare port for sockets bound to
+// the wildcard address, host:port for others, and the path for unix
+// sockets
+func socketSpec(fd int) (string, error) {
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		return "", err
+	}
+
+	var ip net.IP
+	var port int
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		ip, port = net.IP(sa.Addr[:]), sa.Port
+	case *syscall.SockaddrInet6:
+		ip, port = net.IP(sa.Addr[:]), sa.Port
+	case *syscall.SockaddrUnix:
+		return sa.Name, nil
+	default:
+		return "", fmt.Errorf("unsupported socket type")
+	}
+
+	if ip.IsUnspecified() {
+		return strconv.Itoa(port), nil
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port)), nil
+}
@@ -0,0 +1,53 @@
+// +build !windows
+
+package starter
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestSocketSpec(t *testing.T) {
+	specs := []struct {
+		network  string
+		addr     string
+		wildcard bool
+	}{
+		{"tcp4", "127.0.0.1:0", false},
+		{"tcp4", "0.0.0.0:0", true},
+	}
+
+	for _, spec := range specs {
+		l, err := net.Listen(spec.network, spec.addr)
+		if err != nil {
+			t.Fatalf("Failed to listen: %s", err)
+		}
+		f, err := l.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatalf("Failed to get file from listener: %s", err)
+		}
+
+		got, err := socketSpec(int(f.Fd()))
+		f.Close()
+		port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+		l.Close()
+		if err != nil {
+			t.Errorf("socketSpec failed: %s", err)
+			continue
+		}
+
+		expect := "127.0.0.1:" + port
+		if spec.wildcard {
+			expect = port
+		}
+		if got != expect {
+			t.Errorf("Expected spec '%s', got '%s'", expect, got)
+		}
+	}
+
+	if _, err := socketSpec(-1); err != syscall.EBADF {
+		t.Errorf("Expected EBADF for a bad fd, got %v", err)
+	}
+}
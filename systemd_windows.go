@@ -0,0 +1,5 @@
+package starter
+
+func systemdListeners() ([]listener, error) {
+	return nil, nil
+}
@@ -0,0 +1,142 @@
+package starter
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// pathSpec is a parsed --path argument, which looks like
+//
+//	path[,mode=0660][,owner=user][,group=group]
+//
+// A path starting with '@' names a socket in the Linux abstract
+// namespace, which has no file system entry at all
+type pathSpec struct {
+	path    string
+	mode    os.FileMode
+	hasMode bool
+	uid     int // -1 if not specified
+	gid     int // -1 if not specified
+}
+
+func parsePathSpec(spec string) (pathSpec, error) {
+	parts := strings.Split(spec, ",")
+	ps := pathSpec{
+		path: strings.TrimSpace(parts[0]),
+		uid:  -1,
+		gid:  -1,
+	}
+	if ps.path == "" {
+		return ps, fmt.Errorf("empty path")
+	}
+
+	if ps.abstract() && !abstractSocketsSupported {
+		return ps, fmt.Errorf("abstract unix sockets are not supported on this platform")
+	}
+
+	for _, opt := range parts[1:] {
+		opt = strings.TrimSpace(opt)
+		i := strings.IndexByte(opt, '=')
+		if i < 0 {
+			return ps, fmt.Errorf("socket option %s requires a value", opt)
+		}
+		name, value := opt[:i], opt[i+1:]
+
+		switch name {
+		case "mode":
+			m, err := strconv.ParseUint(value, 8, 32)
+			if err != nil || m&^0777 != 0 {
+				return ps, fmt.Errorf("invalid mode '%s' (expected octal permission bits such as 0660)", value)
+			}
+			ps.mode = os.FileMode(m)
+			ps.hasMode = true
+		case "owner":
+			uid, err := lookupUid(value)
+			if err != nil {
+				return ps, err
+			}
+			ps.uid = uid
+		case "group":
+			gid, err := lookupGid(value)
+			if err != nil {
+				return ps, err
+			}
+			ps.gid = gid
+		default:
+			return ps, fmt.Errorf("unknown socket option '%s'", name)
+		}
+	}
+
+	if ps.abstract() && (ps.hasMode || ps.uid != -1 || ps.gid != -1) {
+		return ps, fmt.Errorf("mode, owner and group cannot be set on abstract unix sockets")
+	}
+	return ps, nil
+}
+
+func (ps pathSpec) abstract() bool {
+	return strings.HasPrefix(ps.path, "@")
+}
+
+// lookupUid accepts a user name or a numeric uid
+func lookupUid(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGid accepts a group name or a numeric gid
+func lookupGid(name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// isStale reports whether a socket left over by a previous run exists at
+// the path. Anything that is not a socket is reported as an error, as
+// it must not be removed
+func (ps pathSpec) isStale() (bool, error) {
+	if ps.abstract() {
+		return false, nil
+	}
+
+	fl, err := os.Lstat(ps.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if fl.Mode()&os.ModeSocket != os.ModeSocket {
+		return false, fmt.Errorf("refusing to remove %s: file exists and is not a socket", ps.path)
+	}
+	return true, nil
+}
+
+// setPermissions applies mode, owner and group to the socket file
+func (ps pathSpec) setPermissions() error {
+	if ps.hasMode {
+		if err := os.Chmod(ps.path, ps.mode); err != nil {
+			return err
+		}
+	}
+	if ps.uid != -1 || ps.gid != -1 {
+		if err := os.Lchown(ps.path, ps.uid, ps.gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
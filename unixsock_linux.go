@@ -0,0 +1,5 @@
+package starter
+
+// Linux names a unix socket in the abstract namespace when its path
+// starts with a NUL byte, which the net package spells as '@'
+const abstractSocketsSupported = true
@@ -0,0 +1,5 @@
+// +build !linux
+
+package starter
+
+const abstractSocketsSupported = false
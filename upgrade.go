@@ -0,0 +1,177 @@
+// +build !windows
+
+package starter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+// upgradeSignal makes start_server re-exec its own binary, handing the
+// listeners and the running workers over to the new process image.
+// As the pid doesn't change, the workers stay its children
+const upgradeSignal = syscall.SIGUSR2
+
+type upgradeListener struct {
+	Spec    string `json:"spec"`
+	Config  string `json:"config"`
+	Adopted bool   `json:"adopted,omitempty"`
+	Fd      int    `json:"fd"` // -1 for an empty slot
+}
+
+type upgradeState struct {
+	Generation int               `json:"generation"`
+	Worker     int               `json:"worker"`
+	OldWorkers map[int]int       `json:"old_workers"` // pid -> generation
+	Listeners  []upgradeListener `json:"listeners"`
+}
+
+// Upgrading returns true if this process is the result of a superdaemon
+// re-executing itself. Such a process is already detached from the
+// terminal, and must not daemonize again
+func Upgrading() bool {
+	return os.Getenv(UpgradeStateEnvVarName) != ""
+}
+
+// upgrade replaces the running superdaemon with a fresh copy of its
+// executable. It only returns if something went wrong
+func (s *Starter) upgrade(worker *os.Process, oldWorkers map[int]int) error {
+	// The parent death signal is sent when the thread that started the
+	// worker goes away, which exec(2) does to all but one of our threads
+	if s.pdeathsig != nil {
+		return fmt.Errorf("can not upgrade while workers are started with a parent death signal")
+	}
+	// The pipes the worker output is read from are close-on-exec, and the
+	// workers would get SIGPIPE once the new process image is running
+	if s.workerLog != "" {
+		return fmt.Errorf("can not upgrade while the worker output is read through --worker-log")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	state := upgradeState{
+		Generation: s.generation,
+		OldWorkers: oldWorkers,
+	}
+	if worker != nil {
+		state.Worker = worker.Pid
+	}
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, l := range s.listeners {
+		ul := upgradeListener{Spec: l.spec, Config: l.config, Adopted: l.adopted, Fd: -1}
+		if l.listener != nil {
+			f, err := listenerFile(l.listener)
+			if err != nil {
+				return err
+			}
+			files = append(files, f)
+
+			// Unlike the listeners themselves, the dups must survive exec
+			fd := f.Fd()
+			if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0); errno != 0 {
+				return fmt.Errorf("failed to clear close-on-exec on %s: %s", l.spec, errno)
+			}
+			ul.Fd = int(fd)
+		}
+		state.Listeners = append(state.Listeners, ul)
+	}
+
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Log(logger.Notice, fmt.Sprintf("upgrading: executing %s", exe))
+	env := append(os.Environ(), UpgradeStateEnvVarName+"="+string(buf))
+	return syscall.Exec(exe, os.Args, env)
+}
+
+// loadUpgradeState returns the state left by the superdaemon that
+// re-executed itself, or nil if this is a fresh start
+func loadUpgradeState() (*upgradeState, error) {
+	v := os.Getenv(UpgradeStateEnvVarName)
+	if v == "" {
+		return nil, nil
+	}
+	os.Unsetenv(UpgradeStateEnvVarName)
+
+	var state upgradeState
+	if err := json.Unmarshal([]byte(v), &state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", UpgradeStateEnvVarName, err)
+	}
+	if state.Worker <= 0 {
+		return nil, fmt.Errorf("corrupt %s: invalid worker pid %d", UpgradeStateEnvVarName, state.Worker)
+	}
+	for pid := range state.OldWorkers {
+		if pid <= 0 {
+			return nil, fmt.Errorf("corrupt %s: invalid old worker pid %d", UpgradeStateEnvVarName, pid)
+		}
+	}
+	return &state, nil
+}
+
+// resumeListeners restores the listeners, slot by slot, from the fds
+// that were left open across exec
+func (s *Starter) resumeListeners(state *upgradeState) error {
+	for _, ul := range state.Listeners {
+		if ul.Fd < 0 {
+			s.listeners = append(s.listeners, listener{})
+			continue
+		}
+
+		syscall.CloseOnExec(ul.Fd)
+		f := os.NewFile(uintptr(ul.Fd), ul.Spec)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to resume listener %s: %s", ul.Spec, err)
+		}
+		s.listeners = append(s.listeners, listener{listener: l, spec: ul.Spec, config: ul.Config, adopted: ul.Adopted})
+	}
+	return nil
+}
+
+// resumeWorkers starts watching the workers spawned before the upgrade,
+// and returns the current one
+func (s *Starter) resumeWorkers(state *upgradeState, oldWorkers map[int]int, ch chan processState) *os.Process {
+	s.generation = state.Generation
+	for pid, gen := range state.OldWorkers {
+		oldWorkers[pid] = gen
+		s.pgroups[pid] = gen
+		watchProcess(pid, ch)
+	}
+	s.pgroups[state.Worker] = state.Generation
+	s.logger.Log(logger.Notice, fmt.Sprintf("resumed worker %d (generation %d) and %d old worker(s)", state.Worker, state.Generation, len(state.OldWorkers)),
+		logger.F("pid", state.Worker), logger.F("generation", state.Generation))
+	s.metrics.setWorkers(state.Generation, len(state.OldWorkers))
+	return watchProcess(state.Worker, ch)
+}
+
+// watchProcess reports on ch when the child process pid exits
+func watchProcess(pid int, ch chan processState) *os.Process {
+	p, _ := os.FindProcess(pid) // never fails on unix
+	go func() {
+		st, err := p.Wait()
+		if err != nil {
+			ch <- &dummyProcessState{pid: pid, status: failureStatus}
+			return
+		}
+		ch <- st
+	}()
+	return p
+}
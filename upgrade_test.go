@@ -0,0 +1,150 @@
+// +build !windows
+
+package starter
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+func TestLoadUpgradeState(t *testing.T) {
+	defer os.Unsetenv(UpgradeStateEnvVarName)
+
+	os.Unsetenv(UpgradeStateEnvVarName)
+	if state, err := loadUpgradeState(); state != nil || err != nil {
+		t.Errorf("Expected no state on a fresh start, got %v (%v)", state, err)
+	}
+
+	os.Setenv(UpgradeStateEnvVarName, `{"generation":3,"worker":300,"old_workers":{"200":2},"listeners":[{"spec":"80","config":"80","fd":5},{"fd":-1}]}`)
+	state, err := loadUpgradeState()
+	if err != nil {
+		t.Fatalf("loadUpgradeState failed: %s", err)
+	}
+	if state.Generation != 3 || state.Worker != 300 || state.OldWorkers[200] != 2 || len(state.Listeners) != 2 || state.Listeners[0].Fd != 5 || state.Listeners[1].Fd != -1 {
+		t.Errorf("Unexpected state %#v", state)
+	}
+	if v := os.Getenv(UpgradeStateEnvVarName); v != "" {
+		t.Errorf("Expected %s to be removed from the environment, got %q", UpgradeStateEnvVarName, v)
+	}
+
+	for _, v := range []string{
+		`{"generation":3,`,
+		`{"generation":3,"worker":"300"}`,
+		`{"generation":3}`,
+		`{"generation":3,"worker":-1}`,
+		`{"generation":3,"worker":300,"old_workers":{"0":2}}`,
+	} {
+		os.Setenv(UpgradeStateEnvVarName, v)
+		if state, err := loadUpgradeState(); err == nil {
+			t.Errorf("Expected %s to be rejected, got %#v", v, state)
+		}
+	}
+}
+
+func TestResumeListeners(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer l.Close()
+	// resumeListeners takes over the fd, as it would after exec
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("Failed to get file from listener: %s", err)
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatalf("Failed to dup listener: %s", err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+
+	s := &Starter{logger: logger.Leveled(&bufferLogger{})}
+	state := &upgradeState{Listeners: []upgradeListener{
+		{Fd: -1},
+		{Spec: "127.0.0.1:" + port, Config: port, Adopted: true, Fd: fd},
+	}}
+	if err := s.resumeListeners(state); err != nil {
+		t.Fatalf("resumeListeners failed: %s", err)
+	}
+	if len(s.listeners) != 2 {
+		t.Fatalf("Expected 2 listener slots, got %d", len(s.listeners))
+	}
+	if s.listeners[1].listener != nil {
+		defer s.listeners[1].listener.Close()
+	}
+	if s.listeners[0].listener != nil {
+		t.Errorf("Expected the first slot to be empty, got %v", s.listeners[0].listener)
+	}
+	got := s.listeners[1]
+	if got.listener == nil || got.listener.Addr().String() != l.Addr().String() || got.spec != "127.0.0.1:"+port || got.config != port || !got.adopted {
+		t.Errorf("Unexpected listener %#v", got)
+	}
+
+	// Not a socket
+	tmp, err := ioutil.TempFile("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempfile: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	fd, err = syscall.Dup(int(tmp.Fd()))
+	tmp.Close()
+	if err != nil {
+		t.Fatalf("Failed to dup tempfile: %s", err)
+	}
+	s = &Starter{logger: logger.Leveled(&bufferLogger{})}
+	if err := s.resumeListeners(&upgradeState{Listeners: []upgradeListener{{Spec: "80", Fd: fd}}}); err == nil {
+		t.Errorf("Expected a file that is not a socket to be rejected")
+	}
+}
+
+func TestResumeWorkers(t *testing.T) {
+	var pids []int
+	for _, status := range []string{"2", "3"} {
+		cmd := exec.Command("/bin/sh", "-c", "sleep 0.1; exit "+status)
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start shell: %s", err)
+		}
+		pids = append(pids, cmd.Process.Pid)
+	}
+	old, worker := pids[0], pids[1]
+
+	s := &Starter{logger: logger.Leveled(&bufferLogger{}), metrics: newMetrics(), pgroups: make(map[int]int)}
+	oldWorkers := make(map[int]int)
+	ch := make(chan processState)
+	p := s.resumeWorkers(&upgradeState{Generation: 3, Worker: worker, OldWorkers: map[int]int{old: 2}}, oldWorkers, ch)
+
+	if p.Pid != worker {
+		t.Errorf("Expected worker %d, got %d", worker, p.Pid)
+	}
+	if s.generation != 3 {
+		t.Errorf("Expected generation 3, got %d", s.generation)
+	}
+	if len(oldWorkers) != 1 || oldWorkers[old] != 2 {
+		t.Errorf("Unexpected old workers %v", oldWorkers)
+	}
+	if len(s.pgroups) != 2 || s.pgroups[old] != 2 || s.pgroups[worker] != 3 {
+		t.Errorf("Unexpected process groups %v", s.pgroups)
+	}
+
+	statuses := make(map[int]int)
+	for len(statuses) < 2 {
+		select {
+		case st := <-ch:
+			statuses[st.Pid()] = grabExitStatus(st).ExitStatus()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for the workers, got %v", statuses)
+		}
+	}
+	if statuses[old] != 2 || statuses[worker] != 3 {
+		t.Errorf("Unexpected exit statuses %v", statuses)
+	}
+}
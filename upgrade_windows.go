@@ -0,0 +1,32 @@
+package starter
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// upgradeSignal is never delivered on windows
+const upgradeSignal = syscall.Signal(-1)
+
+type upgradeState struct{}
+
+func Upgrading() bool {
+	return false
+}
+
+func (s *Starter) upgrade(worker *os.Process, oldWorkers map[int]int) error {
+	return errors.New("upgrading is not supported on windows")
+}
+
+func loadUpgradeState() (*upgradeState, error) {
+	return nil, nil
+}
+
+func (s *Starter) resumeListeners(state *upgradeState) error {
+	return nil
+}
+
+func (s *Starter) resumeWorkers(state *upgradeState, oldWorkers map[int]int, ch chan processState) *os.Process {
+	return nil
+}
@@ -0,0 +1,112 @@
+package starter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watchdogSpec sets the thresholds above which the current worker is
+// replaced, parsed from "rss=SIZE,cpu=N%[,for=DURATION][,interval=DURATION]"
+type watchdogSpec struct {
+	maxRSS   uint64        // bytes, 0 for no limit
+	maxCPU   float64       // percent of one CPU, 0 for no limit
+	sustain  time.Duration // how long a threshold must be exceeded
+	interval time.Duration // time between samples
+}
+
+func parseWatchdogSpec(spec string) (watchdogSpec, error) {
+	ws := watchdogSpec{sustain: 30 * time.Second, interval: 5 * time.Second}
+	for _, opt := range strings.Split(spec, ",") {
+		opt = strings.TrimSpace(opt)
+		i := strings.IndexByte(opt, '=')
+		if i < 0 {
+			return ws, fmt.Errorf("watchdog option %s requires a value", opt)
+		}
+		name, value := opt[:i], opt[i+1:]
+
+		switch name {
+		case "rss":
+			n, err := parseLimit(value)
+			if err != nil || n == 0 || n == rlimInfinity {
+				return ws, fmt.Errorf("invalid rss threshold '%s'", value)
+			}
+			ws.maxRSS = n
+		case "cpu":
+			n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if err != nil || n <= 0 {
+				return ws, fmt.Errorf("invalid cpu threshold '%s' (expected a percentage such as 90%%)", value)
+			}
+			ws.maxCPU = n
+		case "for", "interval":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 || name == "interval" && d == 0 {
+				return ws, fmt.Errorf("invalid watchdog %s '%s'", name, value)
+			}
+			if name == "for" {
+				ws.sustain = d
+			} else {
+				ws.interval = d
+			}
+		default:
+			return ws, fmt.Errorf("unknown watchdog option %s", name)
+		}
+	}
+	if ws.maxRSS == 0 && ws.maxCPU == 0 {
+		return ws, fmt.Errorf("watchdog requires an rss or cpu threshold")
+	}
+	return ws, nil
+}
+
+// procSample is a measurement of a process at some point in time
+type procSample struct {
+	time    time.Time
+	rss     uint64        // bytes
+	cpuTime time.Duration // user + system time
+}
+
+// watchdog keeps track of how long the current worker has been above
+// the thresholds
+type watchdog struct {
+	spec      watchdogSpec
+	pid       int
+	last      procSample
+	overSince time.Time
+}
+
+// observe records a sample of the worker pid. It returns a description
+// of the measurement once a threshold has been exceeded for long enough
+func (w *watchdog) observe(pid int, sample procSample) (string, bool) {
+	if pid != w.pid {
+		*w = watchdog{spec: w.spec, pid: pid, last: sample}
+		return "", false
+	}
+
+	var cpu float64
+	if elapsed := sample.time.Sub(w.last.time); elapsed > 0 {
+		cpu = float64(sample.cpuTime-w.last.cpuTime) / float64(elapsed) * 100
+	}
+	w.last = sample
+
+	var over []string
+	if w.spec.maxRSS > 0 && sample.rss > w.spec.maxRSS {
+		over = append(over, fmt.Sprintf("rss %d bytes (threshold %d)", sample.rss, w.spec.maxRSS))
+	}
+	if w.spec.maxCPU > 0 && cpu > w.spec.maxCPU {
+		over = append(over, fmt.Sprintf("cpu %.1f%% (threshold %.1f%%)", cpu, w.spec.maxCPU))
+	}
+	if len(over) == 0 {
+		w.overSince = time.Time{}
+		return "", false
+	}
+
+	if w.overSince.IsZero() {
+		w.overSince = sample.time
+	}
+	if d := sample.time.Sub(w.overSince); d >= w.spec.sustain {
+		w.overSince = time.Time{}
+		return fmt.Sprintf("%s for %s", strings.Join(over, ", "), d.Round(time.Millisecond)), true
+	}
+	return "", false
+}
@@ -0,0 +1,56 @@
+package starter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWatchdogSpec(t *testing.T) {
+	ws, err := parseWatchdogSpec("rss=512M,cpu=90%,for=1m,interval=10s")
+	if err != nil {
+		t.Fatalf("parseWatchdogSpec failed: %s", err)
+	}
+	expect := watchdogSpec{maxRSS: 512 << 20, maxCPU: 90, sustain: time.Minute, interval: 10 * time.Second}
+	if ws != expect {
+		t.Errorf("Expected %#v, got %#v", expect, ws)
+	}
+
+	for _, spec := range []string{"", "for=1m", "rss=lots", "cpu=0%", "interval=0s", "mem=1G"} {
+		if _, err := parseWatchdogSpec(spec); err == nil {
+			t.Errorf("Expected parseWatchdogSpec(%q) to fail", spec)
+		}
+	}
+}
+
+func TestWatchdogObserve(t *testing.T) {
+	w := &watchdog{spec: watchdogSpec{maxRSS: 100, maxCPU: 50, sustain: 10 * time.Second}}
+	start := time.Now()
+	at := func(sec int, rss uint64, cpu time.Duration) procSample {
+		return procSample{time: start.Add(time.Duration(sec) * time.Second), rss: rss, cpuTime: cpu}
+	}
+
+	for i, c := range []struct {
+		pid     int
+		sample  procSample
+		tripped bool
+	}{
+		{1, at(0, 50, 0), false},
+		{1, at(5, 200, 0), false},            // rss over since 5s
+		{1, at(10, 200, 0), false},           // for 5s
+		{1, at(15, 200, 0), true},            // for 10s
+		{1, at(20, 50, 0), false},            // back to normal
+		{1, at(25, 50, 4*time.Second), true}, // 80% cpu, with sustain set to 0
+	} {
+		if i == 5 {
+			w.spec.sustain = 0
+		}
+		if _, tripped := w.observe(c.pid, c.sample); tripped != c.tripped {
+			t.Errorf("Sample %d: expected tripped to be %v", i, c.tripped)
+		}
+	}
+
+	// A new worker starts from scratch
+	if _, tripped := w.observe(2, at(30, 200, time.Hour)); tripped {
+		t.Errorf("Expected the first sample of a worker not to trip")
+	}
+}
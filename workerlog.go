@@ -0,0 +1,107 @@
+package starter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+// workerOutput is where the stdout and stderr of a worker go. Depending
+// on the WorkerLog setting, the worker either shares the superdaemon's
+// stdout/stderr, or writes into pipes that are read line by line and
+// sent to the logger or appended to a file that we rotate
+type workerOutput struct {
+	stdout *os.File
+	stderr *os.File
+	pipes  map[string]*os.File // read ends, by stream name
+	owned  []*os.File          // our copies of files given to the worker
+}
+
+// openWorkerOutput prepares the output for the next worker. If the log
+// file can't be opened, the worker falls back to our stdout/stderr
+func (s *Starter) openWorkerOutput() *workerOutput {
+	switch s.workerLog {
+	case "":
+		return &workerOutput{stdout: os.Stdout, stderr: os.Stderr}
+	default:
+		if s.workerLog != "logger" && s.workerFile == nil {
+			f, err := logger.NewFile(s.workerLog, s.logRotation)
+			if err != nil {
+				s.logger.Log(logger.Error, fmt.Sprintf("failed to open worker log %s: %s", s.workerLog, err))
+				return &workerOutput{stdout: os.Stdout, stderr: os.Stderr}
+			}
+			s.workerFile = f
+		}
+
+		o := &workerOutput{pipes: make(map[string]*os.File)}
+		for _, name := range []string{"stdout", "stderr"} {
+			r, w, err := os.Pipe()
+			if err != nil {
+				s.logger.Log(logger.Error, fmt.Sprintf("failed to create pipe for worker %s: %s", name, err))
+				o.abort()
+				return &workerOutput{stdout: os.Stdout, stderr: os.Stderr}
+			}
+			o.pipes[name] = r
+			o.owned = append(o.owned, w)
+			if name == "stdout" {
+				o.stdout = w
+			} else {
+				o.stderr = w
+			}
+		}
+		return o
+	}
+}
+
+// workerStarted is called once the worker is running. Our copies of its
+// output files are closed, and the pipes, if any, start being copied
+func (s *Starter) workerStarted(o *workerOutput, pid, generation int) {
+	for _, f := range o.owned {
+		f.Close()
+	}
+	for name, r := range o.pipes {
+		go s.copyWorkerOutput(r, name, pid, generation)
+	}
+}
+
+// abort releases everything when the worker could not be started
+func (o *workerOutput) abort() {
+	for _, f := range o.owned {
+		f.Close()
+	}
+	for _, r := range o.pipes {
+		r.Close()
+	}
+}
+
+// copyWorkerOutput copies r line by line, until every process holding
+// the write end (the worker, and whatever it spawned) has closed it.
+// Lines are appended as is to the worker log file, or sent to the logger
+// prefixed by the worker's pid and generation
+func (s *Starter) copyWorkerOutput(r *os.File, name string, pid, generation int) {
+	defer r.Close()
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if s.workerFile != nil {
+			if line != "" {
+				s.workerFile.Write([]byte(line))
+			}
+		} else if line = strings.TrimRight(line, "\r\n"); line != "" {
+			s.logger.Log(logger.Info, fmt.Sprintf("[worker %d gen %d %s] %s", pid, generation, name, line),
+				logger.F("pid", pid), logger.F("generation", generation), logger.F("stream", name))
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Log(logger.Error, fmt.Sprintf("failed to read worker %d %s: %s", pid, name, err),
+					logger.F("pid", pid), logger.F("generation", generation))
+			}
+			return
+		}
+	}
+}
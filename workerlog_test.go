@@ -0,0 +1,66 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lestrrat/go-server-starter/logger"
+)
+
+func TestCopyWorkerOutput(t *testing.T) {
+	var l bufferLogger
+	s := &Starter{logger: logger.Leveled(&l)}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %s", err)
+	}
+	w.WriteString("first\r\nsecond\n\nno newline")
+	w.Close()
+
+	s.copyWorkerOutput(r, "stdout", 123, 4)
+
+	expect := bufferLogger{
+		"[worker 123 gen 4 stdout] first",
+		"[worker 123 gen 4 stdout] second",
+		"[worker 123 gen 4 stdout] no newline",
+	}
+	if !reflect.DeepEqual(l, expect) {
+		t.Errorf("Expected %#v, got %#v", expect, l)
+	}
+}
+
+func TestWorkerLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "worker.log")
+	s := &Starter{logger: logger.Leveled(&bufferLogger{}), workerLog: fn}
+	defer s.Teardown()
+	for _, msg := range []string{"one\n", "two\n"} {
+		out := s.openWorkerOutput()
+		if out.stdout == os.Stdout || out.stderr == os.Stderr {
+			t.Fatalf("Expected stdout and stderr to go to %s", fn)
+		}
+		out.stdout.WriteString(msg)
+		for _, f := range out.owned {
+			f.Close()
+		}
+		s.copyWorkerOutput(out.pipes["stdout"], "stdout", 1, 1)
+		s.copyWorkerOutput(out.pipes["stderr"], "stderr", 1, 1)
+	}
+
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %s", fn, err)
+	}
+	if string(buf) != "one\ntwo\n" {
+		t.Errorf("Expected output to be appended, got %q", buf)
+	}
+}